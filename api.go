@@ -0,0 +1,177 @@
+package discordchess
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIHandler serves the read only json api:
+//
+//	GET /games                      games in progress
+//	GET /games/{id}                 a game in progress or recently finished
+//	GET /games/{id}.pgn             the game in pgn
+//	GET /games/{id}/board.png       the board, ?size=<pixels>&flip=true
+//	GET /players/{id}               the ratings and results of a player
+func (c *ChessHandler) APIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			c.apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "games":
+			c.apiGames(w)
+		case len(parts) == 2 && parts[0] == "games" && strings.HasSuffix(parts[1], ".pgn"):
+			c.apiPGN(w, strings.TrimSuffix(parts[1], ".pgn"))
+		case len(parts) == 2 && parts[0] == "games":
+			c.apiGame(w, parts[1])
+		case len(parts) == 3 && parts[0] == "games" && parts[2] == "board.png":
+			c.apiBoard(w, r, parts[1])
+		case len(parts) == 2 && parts[0] == "players":
+			c.apiPlayer(w, parts[1])
+		default:
+			c.apiError(w, http.StatusNotFound, "not found")
+		}
+	})
+}
+
+// writeJSON writes v as json with the status.
+func (c *ChessHandler) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.log.error("failed to encode response", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func (c *ChessHandler) apiError(w http.ResponseWriter, status int, msg string) {
+	c.writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// current returns a copy of v with the clocks at now.
+func current(v *gameView, now time.Time) *gameView {
+	cur := *v
+	cur.Clock = v.clockAt(now)
+	return &cur
+}
+
+func (c *ChessHandler) apiGames(w http.ResponseWriter) {
+	active, _ := c.live.list()
+	now := time.Now().UTC()
+	games := make([]*gameView, 0, len(active))
+	for _, v := range active {
+		games = append(games, current(v, now))
+	}
+	c.writeJSON(w, http.StatusOK, games)
+}
+
+func (c *ChessHandler) apiGame(w http.ResponseWriter, id string) {
+	v := c.live.get(id)
+	if v == nil {
+		c.apiError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	c.writeJSON(w, http.StatusOK, current(v, time.Now().UTC()))
+}
+
+func (c *ChessHandler) apiPGN(w http.ResponseWriter, id string) {
+	v := c.live.get(id)
+	if v == nil {
+		c.apiError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Write([]byte(v.pgn()))
+}
+
+func (c *ChessHandler) apiBoard(w http.ResponseWriter, r *http.Request, id string) {
+	v := c.live.get(id)
+	if v == nil {
+		c.apiError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	size, err := querySize(r)
+	if err != nil {
+		c.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flip := false
+	if s := r.URL.Query().Get("flip"); s != "" {
+		if flip, err = strconv.ParseBool(s); err != nil {
+			c.apiError(w, http.StatusBadRequest, "flip must be true or false")
+			return
+		}
+	}
+	data, err := c.boardPNG(v, size, false, flip)
+	if err != nil {
+		c.apiError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
+}
+
+func (c *ChessHandler) apiPlayer(w http.ResponseWriter, id string) {
+	p, ok := c.players.get(id)
+	if !ok {
+		c.apiError(w, http.StatusNotFound, "player not found")
+		return
+	}
+	c.writeJSON(w, http.StatusOK, p)
+}
+
+// pgnEscape escapes the pgn tag values.
+var pgnEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// pgn returns the game in pgn with the players names and the result.
+func (v *gameView) pgn() string {
+	result := v.Outcome
+	sb := &strings.Builder{}
+	for _, tag := range [][2]string{
+		{"Event", "discordchess"},
+		{"Site", fmt.Sprintf("https://discord.com/channels/%s/%s", v.GuildID, v.ChannelID)},
+		{"Date", v.Started.Format("2006.01.02")},
+		{"White", v.White.Name},
+		{"Black", v.Black.Name},
+		{"Result", result},
+	} {
+		fmt.Fprintf(sb, "[%s \"%s\"]\n", tag[0], pgnEscape.Replace(tag[1]))
+	}
+	if v.Method != "" {
+		fmt.Fprintf(sb, "[Termination \"%s\"]\n", pgnEscape.Replace(v.Method))
+	}
+	sb.WriteString("\n")
+
+	line := 0
+	write := func(s string) {
+		// pgn lines are kept under 80 characters
+		if line > 0 && line+1+len(s) > 79 {
+			sb.WriteString("\n")
+			line = 0
+		}
+		if line > 0 {
+			sb.WriteString(" ")
+			line++
+		}
+		sb.WriteString(s)
+		line += len(s)
+	}
+	for i, m := range v.Moves {
+		if i%2 == 0 {
+			write(fmt.Sprintf("%d.", i/2+1))
+		}
+		write(m)
+	}
+	write(result)
+	sb.WriteString("\n")
+	return sb.String()
+}
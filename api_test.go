@@ -0,0 +1,100 @@
+package discordchess
+
+import (
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIHandler(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	for i, st := range steps(start, moves("e4", "e5")) {
+		c.HandleMessage(s, st.message(i))
+	}
+	g := c.states.game(testChannel)
+
+	srv := httptest.NewServer(c.APIHandler())
+	defer srv.Close()
+
+	code, body := get(t, srv.URL+"/games")
+	games := []gameView{}
+	if err := json.Unmarshal([]byte(body), &games); code != http.StatusOK || err != nil {
+		t.Fatalf("games = %d %q %v", code, body, err)
+	}
+	if len(games) != 1 || games[0].ID != g.id || games[0].White.ID != "white" || len(games[0].Moves) != 2 {
+		t.Errorf("games = %+v, want the game in progress", games)
+	}
+
+	code, body = get(t, srv.URL+"/games/"+g.id)
+	v := gameView{}
+	if err := json.Unmarshal([]byte(body), &v); code != http.StatusOK || err != nil {
+		t.Fatalf("game = %d %q %v", code, body, err)
+	}
+	if v.FEN != g.Position().String() || v.Turn != "white" || v.Clock != nil {
+		t.Errorf("game = %+v", v)
+	}
+
+	code, body = get(t, srv.URL+"/games/"+g.id+"/board.png?size=256&flip=true")
+	im, err := png.Decode(strings.NewReader(body))
+	if code != http.StatusOK || err != nil {
+		t.Fatalf("board = %d %v", code, err)
+	}
+	if b := im.Bounds(); b.Dx() != 256 {
+		t.Errorf("board is %v, want 256 wide", b)
+	}
+	for _, q := range []string{"flip=maybe", "size=1"} {
+		if code, _ := get(t, srv.URL+"/games/"+g.id+"/board.png?"+q); code != http.StatusBadRequest {
+			t.Errorf("board?%s = %d, want %d", q, code, http.StatusBadRequest)
+		}
+	}
+	for _, path := range []string{"/games/nope", "/games/nope.pgn", "/players/nope", "/nope"} {
+		if code, body := get(t, srv.URL+path); code != http.StatusNotFound || !strings.Contains(body, `"error"`) {
+			t.Errorf("%s = %d %q, want %d", path, code, body, http.StatusNotFound)
+		}
+	}
+
+	for i, st := range moves("Qh5", "Nc6", "Bc4", "Nf6", "Qxf7") {
+		c.HandleMessage(s, st.message(i))
+	}
+
+	code, body = get(t, srv.URL+"/games/"+g.id+".pgn")
+	for _, want := range []string{
+		`[White "white"]`,
+		`[Result "1-0"]`,
+		`[Termination "Checkmate"]`,
+		"1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0\n",
+	} {
+		if code != http.StatusOK || !strings.Contains(body, want) {
+			t.Errorf("pgn = %d %q, want %q", code, body, want)
+		}
+	}
+	if code, body := get(t, srv.URL+"/games"); body != "[]\n" {
+		t.Errorf("games = %d %q, want none in progress", code, body)
+	}
+
+	for id, want := range map[string]playerStats{
+		"white": {ID: "white", Rating: 1216, Games: 1, Wins: 1},
+		"black": {ID: "black", Rating: 1184, Games: 1, Losses: 1},
+	} {
+		code, body := get(t, srv.URL+"/players/"+id)
+		p := playerStats{}
+		if err := json.Unmarshal([]byte(body), &p); code != http.StatusOK || err != nil {
+			t.Fatalf("player %s = %d %q %v", id, code, body, err)
+		}
+		p.Name, p.LastGame = "", p.LastGame.UTC()
+		if p.LastGame.IsZero() {
+			t.Errorf("player %s has no last game", id)
+		}
+		want.LastGame = p.LastGame
+		if p != want {
+			t.Errorf("player %s = %+v, want %+v", id, p, want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package discordchess
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEvent is a game event recorded in the audit log.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	GameID  string    `json:"game"`
+	GuildID string    `json:"guild,omitempty"`
+	Channel string    `json:"channel"`
+	UserID  string    `json:"user,omitempty"`
+	Event   string    `json:"event"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// Audit events.
+const (
+	auditCreated      = "created"
+	auditMove         = "move"
+	auditDrawOffered  = "draw offered"
+	auditDrawAccepted = "draw accepted"
+	auditResign       = "resign"
+	auditTimeout      = "timeout"
+	auditAbort        = "abort"
+	auditAdjudicate   = "adjudicate"
+	auditKick         = "kick"
+	auditGameOver     = "game over"
+)
+
+// auditMemoryGames is the number of games whose events are kept in memory.
+const auditMemoryGames = 50
+
+// AuditLog is an append-only log of game events, kept in memory or in a
+// json lines file.
+type AuditLog struct {
+	f      *os.File
+	events []AuditEvent
+	// games are the ids of the games in events, oldest first
+	games []string
+	mu    sync.Mutex
+}
+
+// NewAuditLog returns an audit log kept in memory, only the events of the
+// last auditMemoryGames games are kept.
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+// OpenAuditLog opens the audit log file at path, creating it if needed.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{f: f}, nil
+}
+
+// Close closes the audit log file.
+func (a *AuditLog) Close() error {
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
+
+func (a *AuditLog) record(ev AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		a.remember(ev)
+		return nil
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = a.f.Write(append(data, '\n'))
+	return err
+}
+
+// remember appends ev to the events in memory, dropping the events of the
+// oldest game if ev starts a game over the limit.
+func (a *AuditLog) remember(ev AuditEvent) {
+	known := false
+	for _, id := range a.games {
+		known = known || id == ev.GameID
+	}
+	if !known {
+		if len(a.games) == auditMemoryGames {
+			oldest := a.games[0]
+			a.games = a.games[1:]
+			kept := a.events[:0]
+			for _, e := range a.events {
+				if e.GameID != oldest {
+					kept = append(kept, e)
+				}
+			}
+			a.events = kept
+		}
+		a.games = append(a.games, ev.GameID)
+	}
+	a.events = append(a.events, ev)
+}
+
+// find returns the events of the game in the guild in the order they were
+// recorded.
+func (a *AuditLog) find(guildID, gameID string) ([]AuditEvent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	match := func(ev AuditEvent) bool {
+		return ev.GameID == gameID && ev.GuildID == guildID
+	}
+	res := []AuditEvent{}
+	if a.f == nil {
+		for _, ev := range a.events {
+			if match(ev) {
+				res = append(res, ev)
+			}
+		}
+		return res, nil
+	}
+
+	if _, err := a.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(a.f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var ev AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("audit log: %w", err)
+		}
+		if match(ev) {
+			res = append(res, ev)
+		}
+	}
+	return res, sc.Err()
+}
+
+// audit records a game event, failures are logged as the game goes on.
+func (c *ChessHandler) audit(g *game, userID, event, detail string) {
+	ev := AuditEvent{
+		Time:    time.Now().UTC(),
+		GameID:  g.id,
+		GuildID: g.guildID,
+		Channel: g.channelID,
+		UserID:  userID,
+		Event:   event,
+		Detail:  detail,
+	}
+	if err := c.auditLog.record(ev); err != nil {
+		c.log.error("failed to record audit event", err, "game", g.id, "event", event)
+	}
+}
+
+func (c *ChessHandler) cmdAudit(r *request) error {
+	gameID := ""
+	if len(r.args) > 0 {
+		gameID = r.args[0]
+	} else if g := c.states.game(r.m.ChannelID); g != nil {
+		gameID = g.id
+	}
+	if gameID == "" {
+		return GameError(fmt.Sprintf("Usage: `%s`", usage(r.cfg.prefix, r.cmd)))
+	}
+
+	events, err := c.auditLog.find(r.m.GuildID, gameID)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return GameError(fmt.Sprintf("No events for game %q", gameID))
+	}
+
+	sb := &strings.Builder{}
+	for _, ev := range events {
+		fmt.Fprintf(sb, "%s %s", ev.Time.Format("2006-01-02 15:04:05"), ev.Event)
+		if ev.UserID != "" {
+			fmt.Fprintf(sb, " by %s", ev.UserID)
+		}
+		if ev.Detail != "" {
+			fmt.Fprintf(sb, ": %s", ev.Detail)
+		}
+		sb.WriteByte('\n')
+	}
+	// discord messages are limited to 2000 characters
+	if sb.Len() > 1900 {
+		_, err := r.s.ChannelFileSend(r.m.ChannelID, fmt.Sprintf("audit-%s.txt", gameID), strings.NewReader(sb.String()))
+		return err
+	}
+	_, err = r.s.ChannelMessageSend(r.m.ChannelID, fmt.Sprintf("Game `%s`:\n```\n%s```", gameID, sb))
+	return err
+}
@@ -0,0 +1,105 @@
+package discordchess
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	for _, file := range []bool{false, true} {
+		name := "memory"
+		if file {
+			name = "file"
+		}
+		t.Run(name, func(t *testing.T) {
+			a := NewAuditLog()
+			if file {
+				var err error
+				a, err = OpenAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer a.Close()
+			}
+			c, err := New("!", "", []string{"guild:admin"}, WithAuditLog(a))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newFakeSession("bot")
+			for i, st := range steps(start, moves("e4", "e5"), []step{
+				{author: "white", content: "!draw"},
+				{author: "black", content: "!draw"},
+			}) {
+				c.HandleMessage(s, st.message(i))
+				if i == 0 {
+					// a game in another guild must not show up
+					c.auditLog.record(AuditEvent{GameID: c.states.game(testChannel).id, GuildID: "other", Event: auditMove})
+				}
+			}
+
+			s.reset()
+			if len(s.embeds) != 1 || s.embeds[0].Footer == nil {
+				t.Fatal("no game over card")
+			}
+			gameID := strings.TrimPrefix(s.embeds[0].Footer.Text, "Game ID: ")
+			if gameID == "" {
+				t.Fatal("no game id in the game over card")
+			}
+
+			c.HandleMessage(s, step{author: "admin", content: "!audit " + gameID, roles: []string{"admin"}}.message(10))
+			got := s.reset()
+			if len(got) != 1 {
+				t.Fatalf("sends %v, want the audit", got)
+			}
+			events := []string{
+				"created by white: white white, black black, time control none",
+				"move by white: e4",
+				"move by black: e5",
+				"draw offered by white",
+				"draw accepted by black",
+				"game over: 1/2-1/2 DrawOffer: 1.e4 e5  1/2-1/2",
+			}
+			lines := strings.Split(strings.Trim(got[0].content, "`\n"), "\n")[2:]
+			if len(lines) != len(events) {
+				t.Fatalf("audit\n%s\nwant %d events", got[0].content, len(events))
+			}
+			for i, l := range lines {
+				// skip the time
+				if l = strings.SplitN(l, " ", 3)[2]; l != events[i] {
+					t.Errorf("event %d %q, want %q", i, l, events[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAuditMemoryLimit(t *testing.T) {
+	a := NewAuditLog()
+	for i := 0; i <= auditMemoryGames; i++ {
+		id := fmt.Sprint("game", i)
+		for _, ev := range []string{auditCreated, auditMove, auditGameOver} {
+			if err := a.record(AuditEvent{GameID: id, GuildID: "guild", Event: ev}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// the first game's move comes after the next one started
+	if err := a.record(AuditEvent{GameID: "game1", GuildID: "guild", Event: auditMove}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(a.events); n != 3*auditMemoryGames+1 {
+		t.Errorf("%d events in memory, want %d", n, 3*auditMemoryGames+1)
+	}
+	for id, want := range map[string]int{"game0": 0, "game1": 4, fmt.Sprint("game", auditMemoryGames): 3} {
+		events, err := a.find("guild", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != want {
+			t.Errorf("%s has %d events, want %d", id, len(events), want)
+		}
+	}
+}
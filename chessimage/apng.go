@@ -0,0 +1,351 @@
+package chessimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// APNGOptions configures the apng encoding.
+type APNGOptions struct {
+	// Delay of each position and of the last one in 100ths of a second.
+	Delay     int
+	LastDelay int
+	// Slide is the number of frames used to slide the moving piece of
+	// each frame and SlideDelay the delay of each of them, moves are not
+	// animated if zero.
+	Slide      int
+	SlideDelay int
+	// MaxBytes is the budget for the encoded apng, if not zero the size
+	// is lowered, the slides dropped and frames skipped until it fits.
+	MaxBytes int
+}
+
+// apngFrame is an encoded frame positioned in the canvas.
+type apngFrame struct {
+	im    image.Image
+	delay int
+}
+
+// EncodeAPNG writes an animated png of frames to w in true color, frames
+// with a Move get the piece slid from the origin square.
+func (d *Drawer) EncodeAPNG(w io.Writer, frames []Frame, opts APNGOptions) error {
+	if len(frames) == 0 {
+		return errors.New("no frames to encode")
+	}
+	if opts.MaxBytes <= 0 {
+		out, err := d.renderAPNG(frames, opts)
+		if err != nil {
+			return err
+		}
+		return writeAPNG(w, out)
+	}
+
+	dr, step := d, 1
+	defer func() {
+		if dr != d {
+			dr.Close()
+		}
+	}()
+	buf := &bytes.Buffer{}
+	for {
+		out, err := dr.renderAPNG(skipFrames(frames, step), opts)
+		if err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := writeAPNG(buf, out); err != nil {
+			return err
+		}
+		if buf.Len() <= opts.MaxBytes {
+			break
+		}
+		// Lower the resolution first, then stop sliding and drop frames
+		switch {
+		case dr.size/2 >= MinSize:
+			smaller, err := d.Resize(dr.size / 2)
+			if err != nil {
+				return err
+			}
+			if dr != d {
+				dr.Close()
+			}
+			dr = smaller
+		case opts.Slide > 1:
+			opts.Slide = 0
+		case step < len(frames):
+			step *= 2
+		default:
+			// nothing else to do, send it anyway
+			_, err := buf.WriteTo(w)
+			return err
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// renderAPNG renders the frames and their slides, frames after the first
+// only contain the bounds of the changed squares.
+func (d *Drawer) renderAPNG(frames []Frame, opts APNGOptions) ([]apngFrame, error) {
+	var out []apngFrame
+	var prev *image.RGBA
+	add := func(cur *image.RGBA, delay int) {
+		r := cur.Bounds()
+		if prev != nil {
+			r = d.changedRect(prev, cur)
+			if r.Empty() {
+				r = image.Rect(0, 0, 1, 1)
+			}
+		}
+		out = append(out, apngFrame{cur.SubImage(r), delay})
+		prev = cur
+	}
+	for i, f := range frames {
+		if prev != nil && len(f.Move) == 2 {
+			for k := 1; k < opts.Slide; k++ {
+				im, err := d.slideImage(f, easeInOut(float64(k)/float64(opts.Slide)))
+				if err != nil {
+					return nil, err
+				}
+				add(im, opts.SlideDelay)
+			}
+		}
+		im, err := d.Image(f.FEN, f.Marks...)
+		if err != nil {
+			return nil, err
+		}
+		delay := opts.Delay
+		if i == len(frames)-1 && opts.LastDelay != 0 {
+			delay = opts.LastDelay
+		}
+		add(im, delay)
+	}
+	return out, nil
+}
+
+// slideImage renders the frame with its moving piece a t portion of the way
+// from the origin to the destination square.
+func (d *Drawer) slideImage(f Frame, t float64) (*image.RGBA, error) {
+	from, to := f.Move[0], f.Move[1]
+	fen, letter := fenWithout(f.FEN, to)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, d.size, d.size))
+	if err := d.Draw(rgba, fen, f.Marks...); err != nil {
+		return nil, err
+	}
+	if letter == 0 {
+		return rgba, nil
+	}
+	delta := d.squareRect(from[0], from[1]).Min.Sub(d.squareRect(to[0], to[1]).Min)
+	off := image.Pt(
+		int(math.Round(float64(delta.X)*(1-t))),
+		int(math.Round(float64(delta.Y)*(1-t))),
+	)
+	p := PieceWhite
+	if unicode.IsLower(letter) {
+		p = PieceBlack
+	}
+	d.drawPieceAt(rgba, to[0], to[1], off, p, piecesMap[unicode.ToLower(letter)])
+	return rgba, nil
+}
+
+func easeInOut(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// fenWithout returns the fen with the square at pos emptied and the fen
+// letter of the piece that was there, 0 if none.
+func fenWithout(fen string, pos [2]int) (string, rune) {
+	rest := ""
+	if i := strings.IndexByte(fen, ' '); i >= 0 {
+		fen, rest = fen[:i], fen[i:]
+	}
+	rows := strings.Split(fen, "/")
+	if pos[1] < 0 || pos[1] >= len(rows) {
+		return fen + rest, 0
+	}
+
+	// expand the row to a square per rune
+	row := []rune{}
+	for _, r := range rows[pos[1]] {
+		if r >= '1' && r <= '8' {
+			row = append(row, []rune(strings.Repeat(" ", int(r-'0')))...)
+			continue
+		}
+		row = append(row, r)
+	}
+	if pos[0] < 0 || pos[0] >= len(row) || row[pos[0]] == ' ' {
+		return fen + rest, 0
+	}
+	letter := row[pos[0]]
+	row[pos[0]] = ' '
+
+	sb := strings.Builder{}
+	empty := 0
+	for _, r := range row {
+		if r == ' ' {
+			empty++
+			continue
+		}
+		if empty > 0 {
+			sb.WriteByte(byte('0' + empty))
+			empty = 0
+		}
+		sb.WriteRune(r)
+	}
+	if empty > 0 {
+		sb.WriteByte(byte('0' + empty))
+	}
+	rows[pos[1]] = sb.String()
+	return strings.Join(rows, "/") + rest, letter
+}
+
+// writeAPNG encodes each frame with image/png and rewrites its image data
+// into apng frame chunks, the first frame sets the canvas. The frames are
+// all encoded as 8 bit rgba if image/png picks different color types for
+// them.
+func writeAPNG(w io.Writer, frames []apngFrame) error {
+	hdrs := make([][]byte, len(frames))
+	data := make([][]byte, len(frames))
+	mixed := false
+	for i, f := range frames {
+		hdr, d, err := pngData(f.im)
+		if err != nil {
+			return err
+		}
+		hdrs[i], data[i] = hdr, d
+		// bit depth, color type, etc must match the canvas
+		mixed = mixed || !bytes.Equal(hdr[8:], hdrs[0][8:])
+	}
+	if mixed {
+		for i, f := range frames {
+			hdrs[i], data[i] = nrgbaData(f.im)
+		}
+	}
+
+	aw := &apngWriter{w: w}
+	aw.write([]byte("\x89PNG\r\n\x1a\n"))
+	for i, f := range frames {
+		if i == 0 {
+			aw.chunk("IHDR", hdrs[0])
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl, uint32(len(frames)))
+			aw.chunk("acTL", actl)
+		}
+
+		b := f.im.Bounds()
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], aw.seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(b.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(b.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(b.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(b.Min.Y))
+		binary.BigEndian.PutUint16(fctl[20:], uint16(f.delay))
+		binary.BigEndian.PutUint16(fctl[22:], 100)
+		// dispose none and blend source, frames are opaque
+		aw.seq++
+		aw.chunk("fcTL", fctl)
+
+		if i == 0 {
+			aw.chunk("IDAT", data[i])
+			continue
+		}
+		fdat := make([]byte, 4, 4+len(data[i]))
+		binary.BigEndian.PutUint32(fdat, aw.seq)
+		aw.seq++
+		aw.chunk("fdAT", append(fdat, data[i]...))
+	}
+	aw.chunk("IEND", nil)
+	return aw.err
+}
+
+// nrgbaData returns the png header and image data of im converted to 8 bit
+// non premultiplied rgba, rows are not filtered.
+func nrgbaData(im image.Image) ([]byte, []byte) {
+	b := im.Bounds()
+	hdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(b.Dy()))
+	hdr[8], hdr[9] = 8, 6 // bit depth and truecolor with alpha
+
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	row := make([]byte, 1+4*b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(im.At(x, y)).(color.NRGBA)
+			copy(row[1+4*(x-b.Min.X):], []byte{c.R, c.G, c.B, c.A})
+		}
+		zw.Write(row)
+	}
+	zw.Close()
+	return hdr, buf.Bytes()
+}
+
+// pngData encodes im and returns its header and the concatenated image
+// data.
+func pngData(im image.Image) ([]byte, []byte, error) {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, im); err != nil {
+		return nil, nil, err
+	}
+	b := buf.Bytes()[8:]
+	var hdr, data []byte
+	for len(b) >= 12 {
+		n := binary.BigEndian.Uint32(b)
+		if int(n) > len(b)-12 {
+			return nil, nil, errors.New("invalid png chunk")
+		}
+		typ, body := string(b[4:8]), b[8:8+n]
+		switch typ {
+		case "IHDR":
+			hdr = body
+		case "IDAT":
+			data = append(data, body...)
+		}
+		b = b[12+n:]
+	}
+	if len(hdr) != 13 {
+		return nil, nil, errors.New("invalid png header")
+	}
+	return hdr, data, nil
+}
+
+type apngWriter struct {
+	w   io.Writer
+	seq uint32
+	err error
+}
+
+func (a *apngWriter) write(b []byte) {
+	if a.err != nil {
+		return
+	}
+	_, a.err = a.w.Write(b)
+}
+
+func (a *apngWriter) chunk(typ string, data []byte) {
+	hdr := make([]byte, 8)
+	binary.BigEndian.PutUint32(hdr, uint32(len(data)))
+	copy(hdr[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc.Sum32())
+
+	a.write(hdr)
+	a.write(data)
+	a.write(sum)
+}
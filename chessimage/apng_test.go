@@ -0,0 +1,299 @@
+package chessimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readChunks splits an apng into its chunks checking their crc.
+func readChunks(t *testing.T, b []byte) []pngChunk {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Fatal("missing png signature")
+	}
+	b = b[8:]
+	var chunks []pngChunk
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated chunk after %d chunks", len(chunks))
+		}
+		n := int(binary.BigEndian.Uint32(b))
+		if n > len(b)-12 {
+			t.Fatalf("chunk %q is %d bytes, %d left", b[4:8], n, len(b)-12)
+		}
+		c := pngChunk{string(b[4:8]), b[8 : 8+n]}
+		if got, want := binary.BigEndian.Uint32(b[8+n:]), crc32.ChecksumIEEE(b[4:8+n]); got != want {
+			t.Errorf("chunk %d %s crc = %x, want %x", len(chunks), c.typ, got, want)
+		}
+		chunks = append(chunks, c)
+		b = b[12+n:]
+	}
+	return chunks
+}
+
+// apngFrames returns the fcTL of each frame and its image data, checking
+// the sequence numbers.
+func apngFrames(t *testing.T, chunks []pngChunk) ([][]byte, [][]byte) {
+	t.Helper()
+	var fctls, data [][]byte
+	seq := uint32(0)
+	next := func(typ string, b []byte) {
+		if got := binary.BigEndian.Uint32(b); got != seq {
+			t.Errorf("%s sequence = %d, want %d", typ, got, seq)
+		}
+		seq++
+	}
+	for _, c := range chunks {
+		switch c.typ {
+		case "fcTL":
+			next(c.typ, c.data)
+			fctls = append(fctls, c.data)
+		case "IDAT":
+			data = append(data, c.data)
+		case "fdAT":
+			next(c.typ, c.data)
+			data = append(data, c.data[4:])
+		}
+	}
+	if len(fctls) != len(data) {
+		t.Fatalf("%d fcTL for %d frames of data", len(fctls), len(data))
+	}
+	return fctls, data
+}
+
+// framePNG decodes the frame data as a standalone png with the canvas
+// header resized to the frame.
+func framePNG(t *testing.T, ihdr, fctl, data []byte) image.Image {
+	t.Helper()
+	hdr := append([]byte{}, ihdr...)
+	copy(hdr, fctl[4:12])
+	buf := &bytes.Buffer{}
+	aw := &apngWriter{w: buf}
+	aw.write([]byte("\x89PNG\r\n\x1a\n"))
+	aw.chunk("IHDR", hdr)
+	aw.chunk("IDAT", data)
+	aw.chunk("IEND", nil)
+	im, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return im
+}
+
+func sameImage(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	ao, bo := a.Bounds().Min, b.Bounds().Min
+	for y := 0; y < a.Bounds().Dy(); y++ {
+		for x := 0; x < a.Bounds().Dx(); x++ {
+			ca := color.NRGBAModel.Convert(a.At(ao.X+x, ao.Y+y))
+			cb := color.NRGBAModel.Convert(b.At(bo.X+x, bo.Y+y))
+			if ca != cb {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	d, err := NewDrawer(WithSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	frames := []Frame{
+		{FEN: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{FEN: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", Move: [][2]int{{4, 6}, {4, 4}}},
+		{FEN: "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2", Move: [][2]int{{4, 1}, {4, 3}}},
+	}
+	buf := &bytes.Buffer{}
+	opts := APNGOptions{Delay: 50, LastDelay: 200, Slide: 3, SlideDelay: 4}
+	if err := d.EncodeAPNG(buf, frames, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := d.Image(frames[0].FEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameImage(first, want) {
+		t.Error("first frame is not the starting position")
+	}
+
+	chunks := readChunks(t, buf.Bytes())
+	if chunks[0].typ != "IHDR" || chunks[1].typ != "acTL" || chunks[len(chunks)-1].typ != "IEND" {
+		t.Fatalf("chunks start with %s %s and end with %s", chunks[0].typ, chunks[1].typ, chunks[len(chunks)-1].typ)
+	}
+	// the start, then two slides and the position of each move
+	wantDelays := []uint16{50, 4, 4, 50, 4, 4, 200}
+	if n := binary.BigEndian.Uint32(chunks[1].data); n != uint32(len(wantDelays)) {
+		t.Errorf("acTL frames = %d, want %d", n, len(wantDelays))
+	}
+	fctls, data := apngFrames(t, chunks)
+	if len(fctls) != len(wantDelays) {
+		t.Fatalf("got %d frames, want %d", len(fctls), len(wantDelays))
+	}
+
+	canvas := image.NewRGBA(want.Bounds())
+	for i, fctl := range fctls {
+		if delay := binary.BigEndian.Uint16(fctl[20:]); delay != wantDelays[i] {
+			t.Errorf("frame %d delay = %d, want %d", i, delay, wantDelays[i])
+		}
+		r := image.Rect(0, 0, int(binary.BigEndian.Uint32(fctl[4:])), int(binary.BigEndian.Uint32(fctl[8:])))
+		r = r.Add(image.Pt(int(binary.BigEndian.Uint32(fctl[12:])), int(binary.BigEndian.Uint32(fctl[16:]))))
+		if !r.In(canvas.Bounds()) {
+			t.Fatalf("frame %d %v is outside the canvas", i, r)
+		}
+		draw.Draw(canvas, r, framePNG(t, chunks[0].data, fctl, data[i]), image.Point{}, draw.Src)
+	}
+	last, err := d.Image(frames[2].FEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameImage(canvas, last) {
+		t.Error("composed frames are not the last position")
+	}
+}
+
+func TestEncodeAPNGBudget(t *testing.T) {
+	d, err := NewDrawer(WithSize(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	frames := longGame(20)
+	buf := &bytes.Buffer{}
+	if err := d.EncodeAPNG(buf, frames, APNGOptions{Delay: 10}); err != nil {
+		t.Fatal(err)
+	}
+	full := buf.Len()
+
+	budget := full / 2
+	buf.Reset()
+	if err := d.EncodeAPNG(buf, frames, APNGOptions{Delay: 10, MaxBytes: budget}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > budget {
+		t.Errorf("apng size %d over budget %d", buf.Len(), budget)
+	}
+	chunks := readChunks(t, buf.Bytes())
+	if w := binary.BigEndian.Uint32(chunks[0].data); w >= 512 {
+		t.Errorf("expected lower resolution, got %d", w)
+	}
+}
+
+func TestWriteAPNGMixedColors(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.RGBA{10, 20, 30, 255}), image.Point{}, draw.Src)
+	translucent := image.NewNRGBA(image.Rect(1, 1, 3, 3))
+	translucent.Set(1, 1, color.NRGBA{200, 100, 50, 128})
+	gray := image.NewGray(image.Rect(0, 0, 2, 2))
+
+	buf := &bytes.Buffer{}
+	frames := []apngFrame{{opaque, 10}, {translucent, 10}, {gray, 10}}
+	if err := writeAPNG(buf, frames); err != nil {
+		t.Fatal(err)
+	}
+	chunks := readChunks(t, buf.Bytes())
+	if ihdr := chunks[0].data; ihdr[8] != 8 || ihdr[9] != 6 {
+		t.Errorf("canvas has bit depth %d and color type %d, want 8 bit rgba", ihdr[8], ihdr[9])
+	}
+	fctls, data := apngFrames(t, chunks)
+	for i, f := range frames {
+		if im := framePNG(t, chunks[0].data, fctls[i], data[i]); !sameImage(im, f.im) {
+			t.Errorf("frame %d differs after encoding", i)
+		}
+	}
+}
+
+func TestFenWithout(t *testing.T) {
+	tests := []struct {
+		fen    string
+		pos    [2]int
+		want   string
+		letter rune
+	}{
+		{
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", [2]int{4, 4},
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 'P',
+		},
+		{
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", [2]int{3, 0},
+			"rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 'q',
+		},
+		{"8/8/8/4k3/8/8/8/4K2R", [2]int{7, 7}, "8/8/8/4k3/8/8/8/4K3", 'R'},
+		{"8/8/8/4k3/8/8/8/4K2R", [2]int{3, 3}, "8/8/8/4k3/8/8/8/4K2R", 0},
+		{"8/8/8/4k3/8/8/8/4K2R", [2]int{8, 0}, "8/8/8/4k3/8/8/8/4K2R", 0},
+		{"8/8/8/4k3/8/8/8/4K2R w - - 0 1", [2]int{0, 8}, "8/8/8/4k3/8/8/8/4K2R w - - 0 1", 0},
+	}
+	for _, tt := range tests {
+		got, letter := fenWithout(tt.fen, tt.pos)
+		if got != tt.want || letter != tt.letter {
+			t.Errorf("fenWithout(%q, %v) = %q %q, want %q %q", tt.fen, tt.pos, got, letter, tt.want, tt.letter)
+		}
+	}
+}
+
+func TestSlideImage(t *testing.T) {
+	d, err := NewDrawer(WithSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	before := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	f := Frame{
+		FEN:  "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		Move: [][2]int{{4, 6}, {4, 4}},
+	}
+	for _, tt := range []struct {
+		t   float64
+		fen string
+	}{{0, before}, {1, f.FEN}} {
+		got, err := d.slideImage(f, tt.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := d.Image(tt.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameImage(got, want) {
+			t.Errorf("slide at %v is not %s", tt.t, tt.fen)
+		}
+	}
+
+	// halfway the pawn is on neither square
+	mid, err := d.slideImage(f, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fen := range []string{before, f.FEN} {
+		im, err := d.Image(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sameImage(mid, im) {
+			t.Errorf("slide halfway is %s", fen)
+		}
+	}
+}
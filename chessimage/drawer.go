@@ -16,6 +16,7 @@ import (
 	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
 )
 
 //go:embed assets/font.ttf
@@ -28,25 +29,92 @@ const (
 	PieceBlack
 )
 
+// MarkStyle defines how a Mark is rendered on each of its squares.
+type MarkStyle int
+
+const (
+	// MarkFill fills the whole square with the mark color.
+	MarkFill = MarkStyle(iota)
+	// MarkDot draws a dot in the center of the square, used to hint legal
+	// destination squares.
+	MarkDot
+	// MarkCheck draws a radial glow under the piece, used to highlight a
+	// king in check.
+	MarkCheck
+	// MarkArrow draws an arrow for each pair of positions, from the first
+	// to the second, knight jumps are drawn as L shaped arrows.
+	MarkArrow
+	// MarkCircle draws a circle around the square.
+	MarkCircle
+)
+
 type Mark struct {
+	Style MarkStyle
 	Color color.Color
 	Pos   [][2]int
+	// Width is the stroke width of arrows and circles relative to the
+	// square size, if zero a default is used.
+	Width float64
 }
 
+// overPieces reports whether the mark is drawn on top of the pieces.
+func (m Mark) overPieces() bool {
+	switch m.Style {
+	case MarkDot, MarkArrow, MarkCircle:
+		return true
+	}
+	return false
+}
+
+const (
+	// MinSize is the smallest image size a Drawer renders.
+	MinSize = 256
+	// MaxSize is the largest image size a Drawer renders.
+	MaxSize = 2048
+	// DefaultSize is the image size without WithSize.
+	DefaultSize = 512
+)
+
 type Drawer struct {
 	squareBlack color.Color
 	squareWhite color.Color
 	pieceBlack  color.Color
 	pieceWhite  color.Color
-	pad         int
 
-	piecesFace font.Face
-	textFace   font.Face
+	// layout, computed from size and the font metrics
+	size      int
+	pad       int
+	square    int
+	baseline  fixed.Int26_6
+	outline   int
+	pieceSize float64
+	textSize  float64
+	glyphs    map[rune]fixed.Rectangle26_6
+
+	// moveRows is the number of rows of the move list in panel images
+	moveRows int
+	// transparent leaves the background around the squares empty
+	transparent bool
+	// flip draws the board from black's side
+	flip bool
+
+	// optional piece set replacing the glyphs, scaled to the square size
+	pieces      PieceSet
+	pieceImages map[rune]image.Image
+
+	// options used to create the drawer, used to resize it
+	opts []func(d *Drawer)
+
+	font         *sfnt.Font
+	piecesFace   font.Face
+	textFace     font.Face
+	capturedFace font.Face
 }
 
 func (d *Drawer) Close() {
 	d.piecesFace.Close()
 	d.textFace.Close()
+	d.capturedFace.Close()
 }
 
 func NewDrawer(opts ...func(d *Drawer)) (*Drawer, error) {
@@ -54,38 +122,122 @@ func NewDrawer(opts ...func(d *Drawer)) (*Drawer, error) {
 	if err != nil {
 		return nil, err
 	}
-	piecesFace, err := opentype.NewFace(sff, &opentype.FaceOptions{
-		Size:    75,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
-	if err != nil {
-		return nil, err
-	}
-	textFace, err := opentype.NewFace(sff, &opentype.FaceOptions{
-		Size:    18,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
-	if err != nil {
-		return nil, err
-	}
 
 	d := &Drawer{
 		squareBlack: color.RGBA{100, 100, 120, 255},
 		squareWhite: color.RGBA{200, 200, 200, 255},
 		pieceBlack:  color.Black,
 		pieceWhite:  color.White,
-		pad:         2 * 8,
-		piecesFace:  piecesFace,
-		textFace:    textFace,
+		size:        DefaultSize,
+		font:        sff,
+		opts:        opts,
 	}
 	for _, fn := range opts {
 		fn(d)
 	}
+	if err := d.layout(); err != nil {
+		return nil, err
+	}
 	return d, nil
 }
 
+// layout computes the squares and the glyph size and positions for the
+// drawer size from the font metrics.
+func (d *Drawer) layout() error {
+	switch {
+	case d.size < MinSize:
+		d.size = MinSize
+	case d.size > MaxSize:
+		d.size = MaxSize
+	}
+	d.pad = d.size / 32
+	d.square = (d.size - d.pad) / 8
+	d.outline = d.size / 512
+
+	// Measure pieces in a reference size and scale the face so the
+	// biggest piece fits in the square with some margin
+	const refSize = 100
+	refFace, err := newFace(d.font, refSize)
+	if err != nil {
+		return err
+	}
+	defer refFace.Close()
+	ext, err := glyphsExtent(refFace)
+	if err != nil {
+		return err
+	}
+	ref := ext.Max.Y - ext.Min.Y
+	if w := ext.Max.X - ext.Min.X; w > ref {
+		ref = w
+	}
+	d.pieceSize = refSize * 0.85 * float64(d.square) / (float64(ref) / 64)
+
+	if d.piecesFace, err = newFace(d.font, d.pieceSize); err != nil {
+		return err
+	}
+	d.glyphs = map[rune]fixed.Rectangle26_6{}
+	for _, r := range piecesMap {
+		b, _, _ := d.piecesFace.GlyphBounds(r)
+		d.glyphs[r] = b
+	}
+	// All pieces share the baseline, centered on the union of the glyphs
+	ext, _ = glyphsExtent(d.piecesFace)
+	d.baseline = (fixed.I(d.square)-(ext.Max.Y-ext.Min.Y))/2 - ext.Min.Y
+
+	d.textSize = float64(d.pad) * 1.1
+	if d.textFace, err = newFace(d.font, d.textSize); err != nil {
+		return err
+	}
+	if d.capturedFace, err = newFace(d.font, d.pieceSize*0.4); err != nil {
+		return err
+	}
+
+	if d.pieces == nil {
+		return nil
+	}
+	d.pieceImages = map[rune]image.Image{}
+	for p := range pieceNames {
+		im, err := d.pieces.Piece(p, d.square)
+		if err != nil {
+			return err
+		}
+		d.pieceImages[p] = im
+	}
+	return nil
+}
+
+// glyphsExtent returns the union of the bounds of all piece glyphs.
+func glyphsExtent(f font.Face) (fixed.Rectangle26_6, error) {
+	var ext fixed.Rectangle26_6
+	for _, r := range piecesMap {
+		b, _, ok := f.GlyphBounds(r)
+		if !ok {
+			return ext, fmt.Errorf("font has no glyph for %c", r)
+		}
+		ext = ext.Union(b)
+	}
+	return ext, nil
+}
+
+func newFace(f *sfnt.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// Resize returns a new drawer with the same options and the given size.
+func (d *Drawer) Resize(size int) (*Drawer, error) {
+	opts := append([]func(d *Drawer){}, d.opts...)
+	return NewDrawer(append(opts, WithSize(size))...)
+}
+
+// Size returns the width and height of the images produced by the drawer.
+func (d *Drawer) Size() int {
+	return d.size
+}
+
 var piecesMap = map[rune]rune{
 	'r': '♜',
 	'n': '♞',
@@ -95,8 +247,22 @@ var piecesMap = map[rune]rune{
 	'p': '♟',
 }
 
+// pieceLetter returns the fen letter of the glyph r with color p.
+func pieceLetter(p Piece, r rune) rune {
+	for l, g := range piecesMap {
+		if g != r {
+			continue
+		}
+		if p == PieceWhite {
+			return unicode.ToUpper(l)
+		}
+		return l
+	}
+	return 0
+}
+
 func (d *Drawer) Image(fen string, marks ...Mark) (*image.RGBA, error) {
-	rgba := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	rgba := image.NewRGBA(image.Rect(0, 0, d.size, d.size))
 	if err := d.Draw(rgba, fen, marks...); err != nil {
 		return nil, err
 	}
@@ -104,7 +270,7 @@ func (d *Drawer) Image(fen string, marks ...Mark) (*image.RGBA, error) {
 }
 
 func (d *Drawer) ImagePaletted(fen string, marks ...Mark) (*image.Paletted, error) {
-	rgba := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	rgba := image.NewRGBA(image.Rect(0, 0, d.size, d.size))
 	if err := d.Draw(rgba, fen, marks...); err != nil {
 		return nil, err
 	}
@@ -125,43 +291,34 @@ func (d *Drawer) ImagePaletted(fen string, marks ...Mark) (*image.Paletted, erro
 	return im, nil
 }
 
+// Draw draws the board on im, im bounds are expected to be of the drawer
+// size.
 func (d *Drawer) Draw(im draw.Image, fen string, marks ...Mark) error {
+	r := im.Bounds()
+
 	// Fill with some color
 	draw.Src.Draw(
 		im,
-		im.Bounds(),
-		image.NewUniform(mulColor(d.squareWhite, .9)),
+		r,
+		d.background(.9),
 		image.Point{},
 	)
 
-	r := im.Bounds()
-
 	// Draw checker pattern
-	s := (r.Dx() - d.pad) / 8
 	for sy := 0; sy < 8; sy++ {
 		for sx := 0; sx < 8; sx++ {
-			x, y := d.pad+sx*s, sy*s
 			draw.Src.Draw(
 				im,
-				image.Rect(x, y, x+s, y+s),
+				d.squareRect(sx, sy).Add(r.Min),
 				image.NewUniform(d.squareColor(sx, sy)),
 				image.Point{},
 			)
 		}
 	}
-	// Draw marks
+	// Draw marks, annotations go over the pieces so they remain visible
 	for _, m := range marks {
-		for _, p := range m.Pos {
-			x, y := d.pad+p[0]*s, p[1]*s
-			draw.DrawMask(
-				im,
-				image.Rect(x, y, x+s, y+s),
-				image.NewUniform(m.Color),
-				image.Pt(0, 0),
-				image.NewUniform(m.Color),
-				image.Pt(0, 0),
-				draw.Over,
-			)
+		if !m.overPieces() {
+			d.drawMark(im, m)
 		}
 	}
 
@@ -170,24 +327,123 @@ func (d *Drawer) Draw(im draw.Image, fen string, marks ...Mark) error {
 		return err
 	}
 
+	for _, m := range marks {
+		if m.overPieces() {
+			d.drawMark(im, m)
+		}
+	}
+
 	// Draw rulers
+	d.rulers(func(dot fixed.Point26_6, s string) {
+		d.drawText(im, dot.Add(fixed.P(r.Min.X, r.Min.Y)), color.Black, s)
+	})
+	return nil
+}
+
+// rulers calls fn with the text and dot position of each rank and file
+// label.
+func (d *Drawer) rulers(fn func(dot fixed.Point26_6, s string)) {
+	// Depending on the font the heights might come negative
+	m := d.textFace.Metrics()
+	capHeight, xHeight := absFixed(m.CapHeight), absFixed(m.XHeight)
+	gutter := fixed.I(d.size - 8*d.square)
 	for i := 0; i < 8; i++ {
-		d.drawText(
-			im,
-			d.pad/8,
-			s/2+s*i,
-			color.Black,
-			fmt.Sprintf("%d", 8-i),
-		)
-		d.drawText(
-			im,
-			d.pad+s/2+s*i,
-			r.Dy()-d.textFace.Metrics().Descent.Ceil(),
-			color.Black,
-			fmt.Sprintf("%c", 'a'+i),
-		)
+		rank, file := fmt.Sprintf("%d", 8-i), fmt.Sprintf("%c", 'a'+i)
+		if d.flip {
+			rank, file = fmt.Sprintf("%d", i+1), fmt.Sprintf("%c", 'h'-i)
+		}
+		w := font.MeasureString(d.textFace, rank)
+		fn(fixed.Point26_6{
+			X: (fixed.I(d.pad) - w) / 2,
+			Y: fixed.I(d.square*i) + (fixed.I(d.square)+capHeight)/2,
+		}, rank)
+
+		w = font.MeasureString(d.textFace, file)
+		fn(fixed.Point26_6{
+			X: fixed.I(d.pad+d.square*i) + (fixed.I(d.square)-w)/2,
+			Y: fixed.I(8*d.square) + (gutter+xHeight)/2,
+		}, file)
 	}
-	return nil
+}
+
+func absFixed(v fixed.Int26_6) fixed.Int26_6 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// screen returns the column and row where the square at sx,sy is drawn.
+func (d *Drawer) screen(sx, sy int) (int, int) {
+	if d.flip {
+		return 7 - sx, 7 - sy
+	}
+	return sx, sy
+}
+
+// squareRect returns the rectangle of the square at sx,sy relative to the
+// board origin.
+func (d *Drawer) squareRect(sx, sy int) image.Rectangle {
+	sx, sy = d.screen(sx, sy)
+	x, y := d.pad+sx*d.square, sy*d.square
+	return image.Rect(x, y, x+d.square, y+d.square)
+}
+
+func (d *Drawer) drawMark(im draw.Image, m Mark) {
+	src := image.NewUniform(m.Color)
+	b := im.Bounds()
+	s := d.square
+	if m.Style == MarkArrow {
+		z := vector.NewRasterizer(b.Dx(), b.Dy())
+		for i := 0; i+1 < len(m.Pos); i += 2 {
+			from, to := m.Pos[i], m.Pos[i+1]
+			arrowPath(
+				z,
+				d.squareCenter(from),
+				d.squareCenter(to),
+				knightJump(from, to),
+				float32(s)*m.width(),
+			)
+		}
+		z.Draw(im, b, src, image.Point{})
+		return
+	}
+	for _, p := range m.Pos {
+		r := d.squareRect(p[0], p[1]).Add(b.Min)
+		switch m.Style {
+		case MarkDot:
+			z := vector.NewRasterizer(s, s)
+			circlePath(z, float32(s)/2, float32(s)/2, float32(s)/6)
+			z.Draw(im, r, src, image.Point{})
+		case MarkCircle:
+			z := vector.NewRasterizer(s, s)
+			w := float32(s) * m.width()
+			ringPath(z, float32(s)/2, float32(s)/2, (float32(s)-w)/2, w)
+			z.Draw(im, r, src, image.Point{})
+		case MarkCheck:
+			draw.DrawMask(im, r, src, image.Point{}, radial{s}, image.Point{}, draw.Over)
+		default:
+			draw.Draw(im, r, src, image.Point{}, draw.Over)
+		}
+	}
+}
+
+// squareCenter returns the center of the square at p relative to the board
+// origin.
+func (d *Drawer) squareCenter(p [2]int) vec {
+	s := float32(d.square)
+	sx, sy := d.screen(p[0], p[1])
+	return vec{
+		float32(d.pad) + float32(sx)*s + s/2,
+		float32(sy)*s + s/2,
+	}
+}
+
+func (m Mark) width() float32 {
+	if m.Width <= 0 {
+		return 0.15
+	}
+	return float32(m.Width)
 }
 
 func (d *Drawer) squareColor(sx, sy int) color.Color {
@@ -198,6 +454,13 @@ func (d *Drawer) squareColor(sx, sy int) color.Color {
 }
 
 func (d *Drawer) drawFen(im draw.Image, fen string) error {
+	return walkFen(fen, func(sx, sy int, p Piece, r rune) {
+		d.drawPiece(im, sx, sy, p, r)
+	})
+}
+
+// walkFen calls fn with the square and glyph of each piece in fen.
+func walkFen(fen string, fn func(sx, sy int, p Piece, r rune)) error {
 	rows := strings.Split(fen, "/")
 	for sy, r := range rows {
 		sx := 0
@@ -219,37 +482,36 @@ func (d *Drawer) drawFen(im draw.Image, fen string) error {
 				sx += e
 				continue
 			}
-			d.drawPiece(im, sx, sy, pc, p)
+			fn(sx, sy, pc, p)
 			sx++
 		}
 	}
 	return nil
 }
 
-func (d Drawer) drawText(im draw.Image, x, y int, c color.Color, s string) {
+func (d Drawer) drawText(im draw.Image, dot fixed.Point26_6, c color.Color, s string) {
 	fd := font.Drawer{
 		Dst:  im,
 		Face: d.textFace,
 		Src:  image.NewUniform(c),
-		Dot:  fixed.P(x, y),
+		Dot:  dot,
 	}
 	fd.DrawString(s)
 }
 
 func (d Drawer) drawPiece(im draw.Image, sx, sy int, p Piece, r rune) {
-	s := (im.Bounds().Dx() - d.pad) / 8
-
-	// bnd, _, _ := d.piecesFace.GlyphBounds(r)
-	// n := (bnd.Max.X).Floor()
-	//
-	// Tried with different fonts and no matter if I used font metrics it
-	// would get wrong, at least this values look right with the current
-	// font 'GNU FreeSerif' and 512x512 bounds
-	//
-	fontFixX, fontFixY := 3, -9
+	d.drawPieceAt(im, sx, sy, image.Point{}, p, r)
+}
 
-	ssx := fontFixX + d.pad + sx*s
-	ssy := fontFixY + s + sy*s
+// drawPieceAt draws the piece displaced by off pixels from the square sx,sy.
+func (d Drawer) drawPieceAt(im draw.Image, sx, sy int, off image.Point, p Piece, r rune) {
+	min := im.Bounds().Min.Add(off)
+	if pim, ok := d.pieceImages[pieceLetter(p, r)]; ok {
+		draw.Draw(im, d.squareRect(sx, sy).Add(min), pim, image.Point{}, draw.Over)
+		return
+	}
+	dot := d.pieceDot(sx, sy, r).Add(fixed.P(min.X, min.Y))
+	o := fixed.I(d.outline)
 
 	fd := font.Drawer{
 		Dst:  im,
@@ -265,17 +527,28 @@ func (d Drawer) drawPiece(im draw.Image, sx, sy int, p Piece, r rune) {
 	// Hackery outline
 	{
 		fd.Src = image.NewUniform(border)
-		fd.Dot = fixed.P(ssx-1, ssy-1)
+		fd.Dot = fixed.Point26_6{X: dot.X - o, Y: dot.Y - o}
 		fd.DrawString(sr)
-		fd.Dot = fixed.P(ssx+1, ssy+1)
+		fd.Dot = fixed.Point26_6{X: dot.X + o, Y: dot.Y + o}
 		fd.DrawString(sr)
 	}
 
 	fd.Src = image.NewUniform(c)
-	fd.Dot = fixed.P(ssx, ssy)
+	fd.Dot = dot
 	fd.DrawString(sr)
 }
 
+// pieceDot returns the glyph origin for the piece r at sx,sy relative to the
+// board origin, glyphs are centered horizontally and share the baseline.
+func (d Drawer) pieceDot(sx, sy int, r rune) fixed.Point26_6 {
+	b := d.glyphs[r]
+	sx, sy = d.screen(sx, sy)
+	return fixed.Point26_6{
+		X: fixed.I(d.pad+sx*d.square) + (fixed.I(d.square)-(b.Max.X-b.Min.X))/2 - b.Min.X,
+		Y: fixed.I(sy*d.square) + d.baseline,
+	}
+}
+
 func mulColor(c color.Color, factor float64) color.Color {
 	r, g, b, a := c.RGBA()
 	res := color.RGBA{
@@ -287,6 +560,32 @@ func mulColor(c color.Color, factor float64) color.Color {
 	return res
 }
 
+// WithTransparentBackground leaves the background around the squares and
+// of the panel strips transparent, i.e: for stream overlays, it is meant
+// for png and svg output as gifs have no alpha.
+func WithTransparentBackground() func(d *Drawer) {
+	return func(d *Drawer) {
+		d.transparent = true
+	}
+}
+
+// background returns the uniform filling the image around the squares, the
+// light square color darkened by factor unless transparent.
+func (d *Drawer) background(factor float64) *image.Uniform {
+	if d.transparent {
+		return image.Transparent
+	}
+	return image.NewUniform(mulColor(d.squareWhite, factor))
+}
+
+// WithFlip draws the board from black's side, with the eighth rank at the
+// bottom.
+func WithFlip() func(d *Drawer) {
+	return func(d *Drawer) {
+		d.flip = true
+	}
+}
+
 func WithSquareColors(w, b color.Color) func(d *Drawer) {
 	return func(d *Drawer) {
 		d.squareWhite = w
@@ -294,6 +593,14 @@ func WithSquareColors(w, b color.Color) func(d *Drawer) {
 	}
 }
 
+// WithSize sets the width and height of the rendered board, it is clamped
+// between MinSize and MaxSize.
+func WithSize(size int) func(d *Drawer) {
+	return func(d *Drawer) {
+		d.size = size
+	}
+}
+
 func WithPieceColors(w, b color.Color) func(d *Drawer) {
 	return func(d *Drawer) {
 		d.pieceWhite = w
@@ -0,0 +1,117 @@
+package chessimage
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+)
+
+const startFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+func TestTransparentBackground(t *testing.T) {
+	for _, transparent := range []bool{false, true} {
+		opts := []func(d *Drawer){WithSize(256)}
+		if transparent {
+			opts = append(opts, WithTransparentBackground())
+		}
+		d, err := NewDrawer(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+
+		im, err := d.Image(startFEN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the rulers gutter is in the bottom left corner
+		corner := im.RGBAAt(0, im.Bounds().Max.Y-1)
+		if got := corner.A == 0; got != transparent {
+			t.Errorf("transparent %v: corner is %v", transparent, corner)
+		}
+		// an empty square in the middle of the board
+		r := d.squareRect(3, 4)
+		if sq := im.RGBAAt(r.Min.X+1, r.Min.Y+1); sq.A != 0xff {
+			t.Errorf("transparent %v: square is %v, want opaque", transparent, sq)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := d.SVG(buf, startFEN); err != nil {
+			t.Fatal(err)
+		}
+		bg := `<rect width="256" height="256"`
+		if got := !strings.Contains(buf.String(), bg); got != transparent {
+			t.Errorf("transparent %v: svg background present %v", transparent, !got)
+		}
+	}
+}
+
+func TestFlip(t *testing.T) {
+	// white pieces are the only pure white pixels
+	whiteInTopRow := func(opts ...func(d *Drawer)) int {
+		d, err := NewDrawer(append(opts, WithSize(256))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		im, err := d.Image(startFEN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		r := image.Rect(d.pad, 0, d.pad+8*d.square, d.square)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if c := im.RGBAAt(x, y); c.R == 0xff && c.G == 0xff && c.B == 0xff {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	if n := whiteInTopRow(); n != 0 {
+		t.Errorf("%d white pixels in the top row, want black pieces", n)
+	}
+	if n := whiteInTopRow(WithFlip()); n == 0 {
+		t.Error("no white pixels in the top row of the flipped board")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	for _, size := range []int{MinSize, 300, DefaultSize, 777, 1000, MaxSize} {
+		d, err := NewDrawer(WithSize(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Size() != size {
+			t.Errorf("size %d: drawer size %d", size, d.Size())
+		}
+		board := d.squareRect(7, 7)
+		if board.Max.X > size || board.Max.Y > size || board.Max.Y+d.pad > size {
+			t.Errorf("size %d: last square %v and rulers don't fit", size, board)
+		}
+		// every glyph fits in its square at the shared baseline
+		for _, r := range piecesMap {
+			b := d.glyphs[r]
+			dot := d.pieceDot(3, 3, r)
+			sq := d.squareRect(3, 3)
+			if (b.Min.X+dot.X).Floor() < sq.Min.X || (b.Max.X+dot.X).Ceil() > sq.Max.X ||
+				(b.Min.Y+dot.Y).Floor() < sq.Min.Y || (b.Max.Y+dot.Y).Ceil() > sq.Max.Y {
+				t.Errorf("size %d: glyph %c overflows %v", size, r, sq)
+			}
+		}
+		d.Close()
+	}
+
+	for size, want := range map[int]int{10: MinSize, 1 << 14: MaxSize} {
+		d, err := NewDrawer(WithSize(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Size() != want {
+			t.Errorf("size %d clamped to %d, want %d", size, d.Size(), want)
+		}
+		d.Close()
+	}
+}
@@ -0,0 +1,292 @@
+package chessimage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+)
+
+// Frame is a position in an animation.
+type Frame struct {
+	FEN   string
+	Marks []Mark
+	// Move is the origin and destination of the piece that moved into
+	// this position, used to animate it.
+	Move [][2]int
+}
+
+// GIFOptions configures the gif encoding.
+type GIFOptions struct {
+	// Delay of each frame and of the last one in 100ths of a second.
+	Delay     int
+	LastDelay int
+	// MaxBytes is the budget for the encoded gif, if not zero the size is
+	// lowered and frames are skipped until it fits.
+	MaxBytes int
+}
+
+// EncodeGIF writes an animation of frames to w, frames share a global
+// palette and only the squares that change are encoded after the first
+// one.
+func (d *Drawer) EncodeGIF(w io.Writer, frames []Frame, opts GIFOptions) error {
+	if opts.MaxBytes <= 0 {
+		g, err := d.GIF(frames, opts)
+		if err != nil {
+			return err
+		}
+		return gif.EncodeAll(w, g)
+	}
+
+	dr, step := d, 1
+	defer func() {
+		if dr != d {
+			dr.Close()
+		}
+	}()
+	buf := &bytes.Buffer{}
+	for {
+		g, err := dr.GIF(skipFrames(frames, step), opts)
+		if err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := gif.EncodeAll(buf, g); err != nil {
+			return err
+		}
+		if buf.Len() <= opts.MaxBytes {
+			break
+		}
+		// Lower the resolution first, then drop frames
+		switch {
+		case dr.size/2 >= MinSize:
+			smaller, err := d.Resize(dr.size / 2)
+			if err != nil {
+				return err
+			}
+			if dr != d {
+				dr.Close()
+			}
+			dr = smaller
+		case step < len(frames):
+			step *= 2
+		default:
+			// nothing else to do, send it anyway
+			_, err := buf.WriteTo(w)
+			return err
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// skipFrames keeps one of each step frames, always keeping the last.
+func skipFrames(frames []Frame, step int) []Frame {
+	if step <= 1 {
+		return frames
+	}
+	res := []Frame{}
+	for i := 0; i < len(frames)-1; i += step {
+		res = append(res, frames[i])
+	}
+	return append(res, frames[len(frames)-1])
+}
+
+// GIF renders the frames into an animation with a shared palette, frames
+// after the first only contain the bounds of the changed squares with the
+// unchanged pixels transparent.
+func (d *Drawer) GIF(frames []Frame, opts GIFOptions) (*gif.GIF, error) {
+	pal := d.palette(frames)
+	q := newQuantizer(pal)
+	transparent := uint8(len(pal) - 1)
+
+	g := &gif.GIF{
+		Config: image.Config{
+			ColorModel: pal,
+			Width:      d.size,
+			Height:     d.size,
+		},
+	}
+	var prev *image.RGBA
+	for i, f := range frames {
+		cur, err := d.Image(f.FEN, f.Marks...)
+		if err != nil {
+			return nil, err
+		}
+
+		var frame *image.Paletted
+		if prev == nil {
+			frame = q.paletted(cur, cur.Bounds(), nil, 0)
+		} else {
+			r := d.changedRect(prev, cur)
+			if r.Empty() {
+				// gif frames can't be empty, keep a single pixel
+				r = image.Rect(0, 0, 1, 1)
+			}
+			frame = q.paletted(cur, r, prev, transparent)
+		}
+		prev = cur
+
+		delay := opts.Delay
+		if i == len(frames)-1 && opts.LastDelay != 0 {
+			delay = opts.LastDelay
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, delay)
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	return g, nil
+}
+
+// changedRect returns the union of the squares, and rulers, that differ
+// between a and b.
+func (d *Drawer) changedRect(a, b *image.RGBA) image.Rectangle {
+	var r image.Rectangle
+	cells := []image.Rectangle{
+		image.Rect(0, 0, d.pad, d.size),
+		image.Rect(0, 8*d.square, d.size, d.size),
+	}
+	for sy := 0; sy < 8; sy++ {
+		for sx := 0; sx < 8; sx++ {
+			cells = append(cells, d.squareRect(sx, sy))
+		}
+	}
+	for _, c := range cells {
+		if !equalRect(a, b, c) {
+			r = r.Union(c)
+		}
+	}
+	return r
+}
+
+func equalRect(a, b *image.RGBA, r image.Rectangle) bool {
+	r = r.Intersect(a.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i, j := a.PixOffset(r.Min.X, y), a.PixOffset(r.Max.X, y)
+		if !bytes.Equal(a.Pix[i:j], b.Pix[i:j]) {
+			return false
+		}
+	}
+	return true
+}
+
+// palette builds a palette with the theme and mark colors and the blends
+// between them so anti-aliased edges don't need dithering, the last entry
+// is transparent.
+func (d *Drawer) palette(frames []Frame) color.Palette {
+	keys := []color.Color{
+		d.squareBlack,
+		d.squareWhite,
+		mulColor(d.squareWhite, .9),
+		d.pieceBlack,
+		d.pieceWhite,
+		mulColor(d.pieceWhite, .7),
+		color.Black,
+	}
+	seen := map[color.RGBA]bool{}
+	for _, c := range keys {
+		seen[rgbaOf(c)] = true
+	}
+	// Marks are blended over both square colors
+	for _, f := range frames {
+		for _, m := range f.Marks {
+			for _, sq := range []color.Color{d.squareBlack, d.squareWhite} {
+				c := over(m.Color, sq)
+				if !seen[c] {
+					seen[c] = true
+					keys = append(keys, c)
+				}
+			}
+		}
+	}
+
+	const maxColors = 255
+	pal := color.Palette{}
+	added := map[color.RGBA]bool{}
+	add := func(c color.RGBA) {
+		if !added[c] && len(pal) < maxColors {
+			added[c] = true
+			pal = append(pal, c)
+		}
+	}
+	for _, c := range keys {
+		add(rgbaOf(c))
+	}
+	// Fill the rest with blends between the most common pairs first
+	for steps := 2; steps <= 8 && len(pal) < maxColors; steps *= 2 {
+		for i := 0; i < len(keys); i++ {
+			for j := i + 1; j < len(keys); j++ {
+				for k := 1; k < steps; k++ {
+					add(lerpColor(rgbaOf(keys[i]), rgbaOf(keys[j]), float64(k)/float64(steps)))
+				}
+			}
+		}
+	}
+	return append(pal, color.RGBA{})
+}
+
+func rgbaOf(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+// over returns c composed over the opaque color bg.
+func over(c, bg color.Color) color.RGBA {
+	sr, sg, sb, sa := c.RGBA()
+	br, bgg, bb, _ := bg.RGBA()
+	k := 0xffff - sa
+	return color.RGBA{
+		uint8((sr + br*k/0xffff) >> 8),
+		uint8((sg + bgg*k/0xffff) >> 8),
+		uint8((sb + bb*k/0xffff) >> 8),
+		0xff,
+	}
+}
+
+func lerpColor(a, b color.RGBA, t float64) color.RGBA {
+	l := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*t)
+	}
+	return color.RGBA{l(a.R, b.R), l(a.G, b.G), l(a.B, b.B), 0xff}
+}
+
+// quantizer maps colors to the nearest palette index caching the results.
+type quantizer struct {
+	pal   color.Palette
+	cache map[color.RGBA]uint8
+}
+
+func newQuantizer(pal color.Palette) *quantizer {
+	return &quantizer{
+		pal:   pal,
+		cache: map[color.RGBA]uint8{},
+	}
+}
+
+func (q *quantizer) index(c color.RGBA) uint8 {
+	if i, ok := q.cache[c]; ok {
+		return i
+	}
+	// skip the transparent entry
+	i := uint8(q.pal[:len(q.pal)-1].Index(c))
+	q.cache[c] = i
+	return i
+}
+
+// paletted converts the r portion of im, if prev is not nil the pixels
+// equal to prev are set to the transparent index.
+func (q *quantizer) paletted(im *image.RGBA, r image.Rectangle, prev *image.RGBA, transparent uint8) *image.Paletted {
+	p := image.NewPaletted(r, q.pal)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			o := im.PixOffset(x, y)
+			px := im.Pix[o : o+4 : o+4]
+			if prev != nil && bytes.Equal(px, prev.Pix[o:o+4]) {
+				p.Pix[p.PixOffset(x, y)] = transparent
+				continue
+			}
+			p.Pix[p.PixOffset(x, y)] = q.index(color.RGBA{px[0], px[1], px[2], px[3]})
+		}
+	}
+	return p
+}
@@ -0,0 +1,107 @@
+package chessimage
+
+import (
+	"bytes"
+	"image/gif"
+	"math/rand"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// longGame plays random moves from a fixed seed until the game ends or the
+// number of plies is reached.
+func longGame(plies int) []Frame {
+	rnd := rand.New(rand.NewSource(1))
+	g := chess.NewGame()
+	frames := []Frame{{FEN: g.Position().String()}}
+	for i := 0; i < plies && g.Outcome() == chess.NoOutcome; i++ {
+		moves := g.ValidMoves()
+		m := moves[rnd.Intn(len(moves))]
+		if err := g.Move(m); err != nil {
+			panic(err)
+		}
+		frames = append(frames, Frame{FEN: g.Position().String()})
+	}
+	return frames
+}
+
+func TestEncodeGIFBudget(t *testing.T) {
+	d, err := NewDrawer(WithSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	frames := longGame(60)
+	buf := &bytes.Buffer{}
+	if err := d.EncodeGIF(buf, frames, GIFOptions{Delay: 10}); err != nil {
+		t.Fatal(err)
+	}
+	full := buf.Len()
+
+	budget := full / 4
+	buf.Reset()
+	if err := d.EncodeGIF(buf, frames, GIFOptions{Delay: 10, MaxBytes: budget}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > budget {
+		t.Errorf("gif size %d over budget %d", buf.Len(), budget)
+	}
+
+	g, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Config.Width >= 1024 {
+		t.Errorf("expected lower resolution, got %d", g.Config.Width)
+	}
+}
+
+func BenchmarkEncodeGIF(b *testing.B) {
+	d, err := NewDrawer()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer d.Close()
+
+	frames := longGame(240)
+	b.Logf("%d frames", len(frames))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := &bytes.Buffer{}
+		if err := d.EncodeGIF(buf, frames, GIFOptions{Delay: 150}); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(buf.Len()), "bytes/gif")
+	}
+}
+
+// BenchmarkEncodeGIFDithered is the previous approach, a full frame per ply
+// with its own palette and dithering, kept for comparison.
+func BenchmarkEncodeGIFDithered(b *testing.B) {
+	d, err := NewDrawer()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer d.Close()
+
+	frames := longGame(240)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g := &gif.GIF{}
+		for _, f := range frames {
+			im, err := d.ImagePaletted(f.FEN, f.Marks...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			g.Image = append(g.Image, im)
+			g.Delay = append(g.Delay, 150)
+		}
+		buf := &bytes.Buffer{}
+		if err := gif.EncodeAll(buf, g); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(buf.Len()), "bytes/gif")
+	}
+}
@@ -0,0 +1,119 @@
+package chessimage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// WithMoveList enables the move list column on panel images showing up to
+// rows full moves.
+func WithMoveList(rows int) func(d *Drawer) {
+	return func(d *Drawer) {
+		d.moveRows = rows
+	}
+}
+
+// moveListWidth returns the width of the move list column, 0 if disabled.
+func (d *Drawer) moveListWidth() int {
+	if d.moveRows <= 0 {
+		return 0
+	}
+	return d.size * 2 / 5
+}
+
+// drawMoveList draws the opening name and the last moves of the panel in
+// two columns in r, the current move is highlighted and a scroll bar shows
+// the position of the visible rows in the whole game.
+func (d *Drawer) drawMoveList(im draw.Image, r image.Rectangle, p Panel) {
+	draw.Draw(im, r, image.NewUniform(mulColor(d.squareWhite, .95)), image.Point{}, draw.Src)
+
+	m := d.textFace.Metrics()
+	lineH := (m.Height * 3 / 2).Ceil()
+	margin := d.pad / 2
+	scrollW := d.pad / 3
+
+	fd := font.Drawer{
+		Dst:  im,
+		Face: d.textFace,
+		Src:  image.NewUniform(color.Black),
+	}
+	text := func(x, y int, s string) {
+		fd.Dot = fixed.P(x, y+(lineH+m.Ascent.Ceil()-m.Descent.Ceil())/2)
+		fd.DrawString(s)
+	}
+
+	y := r.Min.Y + margin
+	if p.Opening != "" {
+		text(r.Min.X+margin, y, truncate(d.textFace, p.Opening, fixed.I(r.Dx()-2*margin)))
+		y += lineH
+		draw.Draw(im, image.Rect(r.Min.X+margin, y, r.Max.X-margin, y+1), image.NewUniform(d.squareBlack), image.Point{}, draw.Src)
+		y += margin
+	}
+
+	// Keep the current move visible, showing the rows before it
+	total := (len(p.Moves) + 1) / 2
+	visible := d.moveRows
+	if fit := (r.Max.Y - margin - y) / lineH; fit < visible {
+		visible = fit
+	}
+	if visible <= 0 {
+		return
+	}
+	current := p.Current
+	if current < 0 || current >= len(p.Moves) {
+		current = len(p.Moves) - 1
+	}
+	first := current/2 - visible + 1
+	if first < 0 {
+		first = 0
+	}
+
+	listTop := y
+	numW := font.MeasureString(d.textFace, fmt.Sprintf("%d.", total)).Ceil() + margin
+	colW := (r.Dx() - 2*margin - numW - scrollW) / 2
+	for row := first; row < first+visible && row < total; row++ {
+		x := r.Min.X + margin
+		text(x, y, fmt.Sprintf("%d.", row+1))
+		x += numW
+		for ply := row * 2; ply < row*2+2 && ply < len(p.Moves); ply++ {
+			if ply == current {
+				draw.Draw(im, image.Rect(x-margin/2, y, x+colW-margin/2, y+lineH), image.NewUniform(d.squareBlack), image.Point{}, draw.Src)
+				fd.Src = image.NewUniform(color.White)
+			}
+			text(x, y, p.Moves[ply])
+			fd.Src = image.NewUniform(color.Black)
+			x += colW
+		}
+		y += lineH
+	}
+
+	// Scroll bar, only when there are hidden rows
+	if total <= visible {
+		return
+	}
+	track := image.Rect(r.Max.X-margin-scrollW, listTop, r.Max.X-margin, listTop+visible*lineH)
+	draw.Draw(im, track, image.NewUniform(mulColor(d.squareWhite, .85)), image.Point{}, draw.Src)
+	thumbH := track.Dy() * visible / total
+	thumbY := track.Min.Y + track.Dy()*first/total
+	draw.Draw(im, image.Rect(track.Min.X, thumbY, track.Max.X, thumbY+thumbH), image.NewUniform(d.squareBlack), image.Point{}, draw.Src)
+}
+
+// truncate shortens s with an ellipsis so it fits in width.
+func truncate(f font.Face, s string, width fixed.Int26_6) string {
+	if font.MeasureString(f, s) <= width {
+		return s
+	}
+	rs := []rune(s)
+	for len(rs) > 0 {
+		rs = rs[:len(rs)-1]
+		if t := string(rs) + "…"; font.MeasureString(f, t) <= width {
+			return t
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package chessimage
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestTruncate(t *testing.T) {
+	d, err := NewDrawer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	long := "Sicilian Defense: Najdorf Variation, English Attack"
+	full := font.MeasureString(d.textFace, long)
+	tests := []struct {
+		width fixed.Int26_6
+		want  string
+	}{
+		{full, long},
+		{full * 2, long},
+		{font.MeasureString(d.textFace, "Sicilian…"), "Sicilian…"},
+		{0, ""},
+	}
+	for _, tt := range tests {
+		got := truncate(d.textFace, long, tt.width)
+		if got != tt.want {
+			t.Errorf("truncate to %v = %q, want %q", tt.width, got, tt.want)
+		}
+		if w := font.MeasureString(d.textFace, got); w > tt.width {
+			t.Errorf("truncate to %v is %v wide", tt.width, w)
+		}
+	}
+}
+
+func TestImagePanelMoveList(t *testing.T) {
+	moves := []string{}
+	for i := 0; i < 60; i++ {
+		moves = append(moves, "Nf3")
+	}
+	for _, rows := range []int{0, 14} {
+		d, err := NewDrawer(WithSize(256), WithMoveList(rows))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+
+		p := Panel{Moves: moves, Current: 20, Opening: "Réti Opening", Eval: &Eval{CP: 30}}
+		im, err := d.ImagePanel(startFEN, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := d.pad*5/2 + 256 + d.moveListWidth()
+		if b := im.Bounds(); b.Dx() != want || b.Dy() != 256+2*d.stripHeight() {
+			t.Errorf("rows %d: panel is %v, want %d wide", rows, b, want)
+		}
+		if rows == 0 && d.moveListWidth() != 0 {
+			t.Error("move list without rows")
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package chessimage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"unicode"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Player is shown in the panel strip of its side.
+type Player struct {
+	Name string
+	// Avatar is optional, it is scaled to fit the strip.
+	Avatar image.Image
+}
+
+// Panel holds the information drawn in the strips above and below the
+// board, black on top and white on the bottom.
+type Panel struct {
+	White Player
+	Black Player
+	// Eval draws an evaluation bar on the left of the board if not nil.
+	Eval *Eval
+
+	// Moves in notation, Current is the index of the highlighted move, the
+	// last one if out of range, and Opening the name of the opening, they
+	// are shown if the drawer has a move list.
+	Moves   []string
+	Current int
+	Opening string
+}
+
+// Eval is an engine evaluation from white's point of view.
+type Eval struct {
+	// CP is the score in centipawns.
+	CP int
+	// Mate is the number of moves to mate if not zero, negative if black
+	// is mating.
+	Mate int
+}
+
+// whiteShare returns the portion of the bar that is white, it maps the
+// centipawns to a winning chance.
+func (e Eval) whiteShare() float64 {
+	switch {
+	case e.Mate > 0:
+		return 1
+	case e.Mate < 0:
+		return 0
+	}
+	return 1 / (1 + math.Exp(-0.004*float64(e.CP)))
+}
+
+func (e Eval) String() string {
+	switch {
+	case e.Mate > 0:
+		return fmt.Sprintf("M%d", e.Mate)
+	case e.Mate < 0:
+		return fmt.Sprintf("-M%d", -e.Mate)
+	}
+	return fmt.Sprintf("%+.1f", float64(e.CP)/100)
+}
+
+// startCount is the number of pieces of each kind at the start of the game.
+var startCount = map[rune]int{'q': 1, 'r': 2, 'b': 2, 'n': 2, 'p': 8}
+
+// pieceValue is the material value of each kind of piece.
+var pieceValue = map[rune]int{'q': 9, 'r': 5, 'b': 3, 'n': 3, 'p': 1}
+
+// Material describes the captured pieces of each side computed from a fen.
+type Material struct {
+	// White and Black are the fen letters of the pieces captured by each
+	// side, from the most valuable to the least.
+	White []rune
+	Black []rune
+	// Diff is the material difference, positive if white is ahead.
+	Diff int
+}
+
+// MaterialFromFEN counts the pieces in the fen and returns the captured
+// pieces for each side.
+func MaterialFromFEN(fen string) Material {
+	board := fen
+	if i := strings.IndexByte(fen, ' '); i >= 0 {
+		board = fen[:i]
+	}
+	count := map[rune]int{}
+	for _, r := range board {
+		count[r]++
+	}
+
+	// white captures the black pieces
+	m := Material{
+		White: missing(count, false),
+		Black: missing(count, true),
+	}
+	for p, v := range pieceValue {
+		m.Diff += (count[unicode.ToUpper(p)] - count[p]) * v
+	}
+	return m
+}
+
+// missing returns the pieces missing from a side, promoted pieces are
+// accounted as missing pawns.
+func missing(count map[rune]int, white bool) []rune {
+	letter := func(p rune) rune {
+		if white {
+			return unicode.ToUpper(p)
+		}
+		return p
+	}
+	promoted := 0
+	for _, p := range "qrbn" {
+		if extra := count[letter(p)] - startCount[p]; extra > 0 {
+			promoted += extra
+		}
+	}
+
+	res := []rune{}
+	for _, p := range "qrbnp" {
+		n := startCount[p] - count[letter(p)]
+		if p == 'p' {
+			n -= promoted
+		}
+		for i := 0; i < n; i++ {
+			res = append(res, letter(p))
+		}
+	}
+	return res
+}
+
+// stripHeight returns the height of each panel strip.
+func (d *Drawer) stripHeight() int {
+	return d.square * 4 / 5
+}
+
+// ImagePanel draws the board with strips above and below showing the
+// players, their captured pieces and the material difference, the
+// evaluation bar on the left if the panel has an evaluation and the move
+// list on the right if enabled in the drawer. Flipped boards have white on
+// top.
+func (d *Drawer) ImagePanel(fen string, p Panel, marks ...Mark) (*image.RGBA, error) {
+	h := d.stripHeight()
+	bar := 0
+	if p.Eval != nil {
+		bar = d.pad * 5 / 2
+	}
+	list := d.moveListWidth()
+	rgba := image.NewRGBA(image.Rect(0, 0, bar+d.size+list, d.size+2*h))
+	draw.Draw(rgba, rgba.Bounds(), d.background(.8), image.Point{}, draw.Src)
+
+	board := rgba.SubImage(image.Rect(bar, h, bar+d.size, d.size+h)).(*image.RGBA)
+	if err := d.Draw(board, fen, marks...); err != nil {
+		return nil, err
+	}
+	if p.Eval != nil {
+		d.drawEvalBar(rgba, image.Rect(0, h, bar, h+8*d.square), *p.Eval)
+	}
+
+	if list > 0 {
+		d.drawMoveList(rgba, image.Rect(bar+d.size, 0, bar+d.size+list, d.size+2*h), p)
+	}
+
+	m := MaterialFromFEN(fen)
+	top, bottom := image.Rect(bar, 0, bar+d.size, h), image.Rect(bar, d.size+h, bar+d.size, d.size+2*h)
+	if d.flip {
+		top, bottom = bottom, top
+	}
+	d.drawStrip(rgba, top, p.Black, m.Black, -m.Diff)
+	d.drawStrip(rgba, bottom, p.White, m.White, m.Diff)
+	return rgba, nil
+}
+
+// drawEvalBar draws the evaluation bar in r with white on the bottom, on
+// top if flipped, and the score written on the side that is ahead.
+func (d *Drawer) drawEvalBar(im draw.Image, r image.Rectangle, e Eval) {
+	white := int(math.Round(e.whiteShare() * float64(r.Dy())))
+	blackRect := image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Max.Y-white)
+	whiteRect := image.Rect(r.Min.X, r.Max.Y-white, r.Max.X, r.Max.Y)
+	if d.flip {
+		whiteRect = image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+white)
+		blackRect = image.Rect(r.Min.X, r.Min.Y+white, r.Max.X, r.Max.Y)
+	}
+	draw.Draw(im, blackRect, image.NewUniform(color.RGBA{50, 50, 50, 255}), image.Point{}, draw.Src)
+	draw.Draw(im, whiteRect, image.NewUniform(color.RGBA{240, 240, 240, 255}), image.Point{}, draw.Src)
+
+	face := d.textFace
+	label := e.String()
+	w := font.MeasureString(face, label)
+	fd := font.Drawer{
+		Dst:  im,
+		Face: face,
+		Src:  image.NewUniform(color.Black),
+		Dot: fixed.Point26_6{
+			X: fixed.I(r.Min.X) + (fixed.I(r.Dx())-w)/2,
+			Y: fixed.I(r.Max.Y - d.pad/4),
+		},
+	}
+	// the label goes on the end of the side ahead, in the color of the
+	// other side
+	if e.whiteShare() < .5 {
+		fd.Src = image.NewUniform(color.White)
+	}
+	if (e.whiteShare() < .5) != d.flip {
+		fd.Dot.Y = fixed.I(r.Min.Y+d.pad/4) + face.Metrics().Ascent
+	}
+	fd.DrawString(label)
+}
+
+// drawStrip draws the avatar, the name, the captured pieces and the
+// material advantage if positive in r.
+func (d *Drawer) drawStrip(im draw.Image, r image.Rectangle, p Player, captured []rune, diff int) {
+	margin := r.Dy() / 8
+	x := r.Min.X + d.pad
+	if p.Avatar != nil {
+		side := r.Dy() - 2*margin
+		dst := image.Rect(x, r.Min.Y+margin, x+side, r.Min.Y+margin+side)
+		xdraw.CatmullRom.Scale(im, dst, p.Avatar, p.Avatar.Bounds(), draw.Over, nil)
+		x += side + margin
+	}
+
+	// Name on top, captures below
+	fd := font.Drawer{
+		Dst:  im,
+		Src:  image.NewUniform(color.Black),
+		Face: d.textFace,
+		Dot:  fixed.P(x, r.Min.Y+margin+d.textFace.Metrics().Ascent.Ceil()),
+	}
+	fd.DrawString(p.Name)
+
+	fd.Face = d.capturedFace
+	fd.Src = image.NewUniform(d.pieceBlack)
+	fd.Dot = fixed.P(x, r.Max.Y-margin)
+	for _, c := range captured {
+		g := piecesMap[unicode.ToLower(c)]
+		if unicode.IsUpper(c) {
+			// white pieces use the outlined glyphs '♔'...
+			g -= '♚' - '♔'
+		}
+		fd.DrawString(string(g))
+	}
+	if diff > 0 {
+		fd.Face = d.textFace
+		fd.Src = image.NewUniform(color.Black)
+		fd.DrawString(fmt.Sprintf(" +%d", diff))
+	}
+}
@@ -0,0 +1,104 @@
+package chessimage
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMaterialFromFEN(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		white string
+		black string
+		diff  int
+	}{
+		{name: "start", fen: startFEN},
+		{
+			name:  "queen captured",
+			fen:   "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNB1KBNR w KQkq - 0 1",
+			black: "Q",
+			diff:  -9,
+		},
+		{
+			name:  "trades",
+			fen:   "r1bqkb1r/ppp2ppp/8/8/8/8/PPP2PPP/R1BQKB1R w KQkq - 0 1",
+			white: "nnpp",
+			black: "NNPP",
+		},
+		{
+			name:  "white promotion",
+			fen:   "rnbqkbnr/ppppppp1/8/8/7Q/8/PPPPPPP1/RNBQKBNR w KQkq - 0 1",
+			white: "p",
+			diff:  9,
+		},
+		{
+			name:  "black underpromotion",
+			fen:   "rnbqkbnr/ppppppp1/8/8/8/8/PPPPPPPP/RNBQKBNn b Qkq - 0 1",
+			black: "R",
+			diff:  -7,
+		},
+		{name: "board only", fen: "4k3/8/8/8/8/8/8/4K3", white: "qrrbbnnpppppppp", black: "QRRBBNNPPPPPPPP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := MaterialFromFEN(tt.fen)
+			if string(m.White) != tt.white || string(m.Black) != tt.black || m.Diff != tt.diff {
+				t.Errorf("got white %q black %q diff %d, want %q %q %d", string(m.White), string(m.Black), m.Diff, tt.white, tt.black, tt.diff)
+			}
+		})
+	}
+}
+
+func TestImagePanelFlip(t *testing.T) {
+	p := Panel{
+		White: Player{Name: "white"},
+		Black: Player{Name: "black"},
+		Eval:  &Eval{CP: 300},
+	}
+	// black is missing a queen so only white's strip shows a capture
+	fen := "rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	panels := map[bool]*image.RGBA{}
+	for _, flip := range []bool{false, true} {
+		opts := []func(d *Drawer){WithSize(256)}
+		if flip {
+			opts = append(opts, WithFlip())
+		}
+		d, err := NewDrawer(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		if panels[flip], err = d.ImagePanel(fen, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := NewDrawer(WithSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	h, bar := d.stripHeight(), d.pad*5/2
+	top := image.Rect(bar, 0, bar+256, h)
+	bottom := top.Add(image.Pt(0, 256+h))
+	if !sameImage(panels[false].SubImage(top), panels[true].SubImage(bottom)) ||
+		!sameImage(panels[false].SubImage(bottom), panels[true].SubImage(top)) {
+		t.Error("flipped panel doesn't swap the player strips")
+	}
+	if sameImage(panels[true].SubImage(top), panels[true].SubImage(bottom)) {
+		t.Error("strips are the same")
+	}
+
+	// white is ahead so the white part of the bar is the longest, on the
+	// bottom and on top if flipped
+	light := color.RGBA{240, 240, 240, 255}
+	x, barTop, barBottom := 1, h, h+8*d.square-1
+	for flip, want := range map[bool][2]bool{false: {false, true}, true: {true, false}} {
+		im := panels[flip]
+		if got := [2]bool{im.RGBAAt(x, barTop) == light, im.RGBAAt(x, barBottom) == light}; got != want {
+			t.Errorf("flip %v: bar ends are white %v, want %v", flip, got, want)
+		}
+	}
+}
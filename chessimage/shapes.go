@@ -0,0 +1,132 @@
+package chessimage
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// kappa is the control point distance to approximate a quarter circle with
+// a cubic bézier.
+const kappa = 0.5522847498
+
+// pather is implemented by the vector rasterizer and by the svg path
+// builder, so shapes can be shared by both renderers.
+type pather interface {
+	MoveTo(ax, ay float32)
+	LineTo(bx, by float32)
+	QuadTo(bx, by, cx, cy float32)
+	CubeTo(bx, by, cx, cy, dx, dy float32)
+	ClosePath()
+}
+
+// circlePath adds a clockwise circle centered at cx,cy to the path.
+func circlePath(z pather, cx, cy, r float32) {
+	k := r * kappa
+	z.MoveTo(cx+r, cy)
+	z.CubeTo(cx+r, cy+k, cx+k, cy+r, cx, cy+r)
+	z.CubeTo(cx-k, cy+r, cx-r, cy+k, cx-r, cy)
+	z.CubeTo(cx-r, cy-k, cx-k, cy-r, cx, cy-r)
+	z.CubeTo(cx+k, cy-r, cx+r, cy-k, cx+r, cy)
+	z.ClosePath()
+}
+
+// radial is an alpha mask of a square of size s that is opaque at the center
+// and fades out towards the edges.
+type radial struct {
+	s int
+}
+
+func (r radial) ColorModel() color.Model { return color.AlphaModel }
+
+func (r radial) Bounds() image.Rectangle { return image.Rect(0, 0, r.s, r.s) }
+
+func (r radial) At(x, y int) color.Color {
+	c := float64(r.s) / 2
+	dist := math.Hypot(float64(x)+.5-c, float64(y)+.5-c) / c
+	if dist >= 1 {
+		return color.Alpha{}
+	}
+	return color.Alpha{uint8((1 - dist*dist) * 255)}
+}
+
+// ringPath adds a ring of width w centered at cx,cy with the outer edge at r,
+// the inner circle is added counter-clockwise to cut the hole.
+func ringPath(z pather, cx, cy, r, w float32) {
+	circlePath(z, cx, cy, r)
+	k := (r - w) * kappa
+	ri := r - w
+	z.MoveTo(cx+ri, cy)
+	z.CubeTo(cx+ri, cy-k, cx+k, cy-ri, cx, cy-ri)
+	z.CubeTo(cx-k, cy-ri, cx-ri, cy-k, cx-ri, cy)
+	z.CubeTo(cx-ri, cy+k, cx-k, cy+ri, cx, cy+ri)
+	z.CubeTo(cx+k, cy+ri, cx+ri, cy+k, cx+ri, cy)
+	z.ClosePath()
+}
+
+type vec struct{ x, y float32 }
+
+func (a vec) add(b vec) vec     { return vec{a.x + b.x, a.y + b.y} }
+func (a vec) sub(b vec) vec     { return vec{a.x - b.x, a.y - b.y} }
+func (a vec) mul(f float32) vec { return vec{a.x * f, a.y * f} }
+func (a vec) perp() vec         { return vec{-a.y, a.x} }
+func (a vec) norm() vec {
+	l := math.Hypot(float64(a.x), float64(a.y))
+	return a.mul(float32(1 / l))
+}
+
+// knightJump reports whether the squares at a and b are a knight move apart.
+func knightJump(a, b [2]int) bool {
+	dx, dy := abs(a[0]-b[0]), abs(a[1]-b[1])
+	return dx == 1 && dy == 2 || dx == 2 && dy == 1
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// arrowPath adds an arrow of stroke width w between two points, if bent is
+// true the shaft goes along the longest axis first and then turns.
+func arrowPath(z pather, from, to vec, bent bool, w float32) {
+	if from == to {
+		return
+	}
+	headLen, headW := w*2.2, w*1.6
+
+	if bent {
+		d := to.sub(from)
+		corner := vec{to.x, from.y}
+		if math.Abs(float64(d.y)) > math.Abs(float64(d.x)) {
+			corner = vec{from.x, to.y}
+		}
+		// extend the first segment to fill the joint
+		dir := corner.sub(from).norm()
+		quadPath(z, from, corner.add(dir.mul(w/2)), w/2)
+		from = corner
+	}
+
+	dir := to.sub(from).norm()
+	// stop the tip a bit before the center so it doesn't cover the piece
+	tip := to.sub(dir.mul(w))
+	base := tip.sub(dir.mul(headLen))
+	quadPath(z, from, base, w/2)
+
+	n := dir.perp().mul(headW)
+	z.MoveTo(base.x+n.x, base.y+n.y)
+	z.LineTo(tip.x, tip.y)
+	z.LineTo(base.x-n.x, base.y-n.y)
+	z.ClosePath()
+}
+
+// quadPath adds a rectangle of half width hw along the segment a-b.
+func quadPath(z pather, a, b vec, hw float32) {
+	n := b.sub(a).norm().perp().mul(hw)
+	z.MoveTo(a.x+n.x, a.y+n.y)
+	z.LineTo(b.x+n.x, b.y+n.y)
+	z.LineTo(b.x-n.x, b.y-n.y)
+	z.LineTo(a.x-n.x, a.y-n.y)
+	z.ClosePath()
+}
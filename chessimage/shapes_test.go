@@ -0,0 +1,78 @@
+package chessimage
+
+import (
+	"math"
+	"testing"
+)
+
+// recorder keeps the points of each sub path.
+type recorder struct {
+	paths [][]vec
+}
+
+func (r *recorder) MoveTo(ax, ay float32)                 { r.paths = append(r.paths, []vec{{ax, ay}}) }
+func (r *recorder) LineTo(bx, by float32)                 { r.add(bx, by) }
+func (r *recorder) QuadTo(bx, by, cx, cy float32)         { r.add(cx, cy) }
+func (r *recorder) CubeTo(bx, by, cx, cy, dx, dy float32) { r.add(dx, dy) }
+func (r *recorder) ClosePath()                            {}
+
+func (r *recorder) add(x, y float32) {
+	last := len(r.paths) - 1
+	r.paths[last] = append(r.paths[last], vec{x, y})
+}
+
+func near(a, b float32) bool { return math.Abs(float64(a-b)) < 1e-3 }
+
+func TestArrowPath(t *testing.T) {
+	const w = 10
+	tests := []struct {
+		name     string
+		from, to vec
+		bent     bool
+		// paths is the number of sub paths: the shafts and the head
+		paths int
+		// corner is where the first shaft ends for bent arrows
+		corner vec
+	}{
+		{name: "straight", from: vec{50, 350}, to: vec{50, 150}, paths: 2},
+		{name: "knight vertical first", from: vec{150, 350}, to: vec{250, 150}, bent: true, paths: 3, corner: vec{150, 150}},
+		{name: "knight horizontal first", from: vec{150, 350}, to: vec{350, 250}, bent: true, paths: 3, corner: vec{350, 350}},
+		{name: "same square", from: vec{50, 50}, to: vec{50, 50}, paths: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			arrowPath(r, tt.from, tt.to, tt.bent, w)
+			if len(r.paths) != tt.paths {
+				t.Fatalf("%d sub paths, want %d", len(r.paths), tt.paths)
+			}
+			if tt.paths == 0 {
+				return
+			}
+			head := r.paths[len(r.paths)-1]
+			// the tip stops a stroke width before the center
+			tip := head[1]
+			if d := tt.to.sub(tip); !near(float32(math.Hypot(float64(d.x), float64(d.y))), w) {
+				t.Errorf("tip %v is not %d from %v", tip, w, tt.to)
+			}
+			if !tt.bent {
+				return
+			}
+			// the first shaft goes from the origin to past the corner
+			shaft := r.paths[0]
+			for _, p := range shaft {
+				dx, dy := math.Abs(float64(p.x-tt.from.x)), math.Abs(float64(p.y-tt.from.y))
+				if tt.corner.x == tt.from.x && !near(float32(dx), w/2) || tt.corner.y == tt.from.y && !near(float32(dy), w/2) {
+					t.Errorf("first shaft point %v off the axis from %v to %v", p, tt.from, tt.corner)
+				}
+			}
+			second := r.paths[1]
+			if d := second[0].sub(tt.corner); math.Hypot(float64(d.x), float64(d.y)) > w {
+				t.Errorf("second shaft starts at %v, want near the corner %v", second[0], tt.corner)
+			}
+		})
+	}
+	if !knightJump([2]int{1, 7}, [2]int{2, 5}) || knightJump([2]int{1, 7}, [2]int{3, 5}) {
+		t.Error("knightJump is wrong")
+	}
+}
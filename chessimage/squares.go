@@ -0,0 +1,82 @@
+package chessimage
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// SquarePos converts a square into drawer coordinates.
+func SquarePos(sq chess.Square) [2]int {
+	return [2]int{int(sq.File()), 7 - int(sq.Rank())}
+}
+
+// ParseSquare parses a square in algebraic notation i.e: "e2".
+func ParseSquare(s string) (chess.Square, bool) {
+	s = strings.ToLower(s)
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return chess.NoSquare, false
+	}
+	return chess.Square(int(s[1]-'1')*8 + int(s[0]-'a')), true
+}
+
+// LastMoveMarks returns the marks highlighting m, the move that led to pos,
+// and the king of pos if m checks it.
+func LastMoveMarks(m *chess.Move, pos *chess.Position) []Mark {
+	marks := []Mark{{
+		Color: color.NRGBA{55, 55, 155, 100},
+		Pos:   [][2]int{SquarePos(m.S1()), SquarePos(m.S2())},
+	}}
+	if m.HasTag(chess.Check) {
+		marks = append(marks, Mark{
+			Style: MarkCheck,
+			Color: color.RGBA{220, 30, 30, 255},
+			Pos:   [][2]int{SquarePos(kingSquare(pos))},
+		})
+	}
+	return marks
+}
+
+// kingSquare returns the square of the king whose turn it is.
+func kingSquare(pos *chess.Position) chess.Square {
+	king := chess.WhiteKing
+	if pos.Turn() == chess.Black {
+		king = chess.BlackKing
+	}
+	for sq, p := range pos.Board().SquareMap() {
+		if p == king {
+			return sq
+		}
+	}
+	return chess.NoSquare
+}
+
+// ParseAnnotations parses a list of arrows "e2e4" and circles "e4" into an
+// arrow mark and a circle mark.
+func ParseAnnotations(args []string) ([]Mark, error) {
+	annColor := color.NRGBA{20, 140, 60, 180}
+	arrows := Mark{Style: MarkArrow, Color: annColor}
+	circles := Mark{Style: MarkCircle, Color: annColor, Width: 0.08}
+	for _, a := range args {
+		switch len(a) {
+		case 2:
+			sq, ok := ParseSquare(a)
+			if !ok {
+				return nil, fmt.Errorf("invalid square %q", a)
+			}
+			circles.Pos = append(circles.Pos, SquarePos(sq))
+		case 4:
+			from, ok1 := ParseSquare(a[:2])
+			to, ok2 := ParseSquare(a[2:])
+			if !ok1 || !ok2 || from == to {
+				return nil, fmt.Errorf("invalid arrow %q", a)
+			}
+			arrows.Pos = append(arrows.Pos, SquarePos(from), SquarePos(to))
+		default:
+			return nil, fmt.Errorf("invalid annotation %q, use e2e4 for arrows and e4 for circles", a)
+		}
+	}
+	return []Mark{arrows, circles}, nil
+}
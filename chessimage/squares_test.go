@@ -0,0 +1,38 @@
+package chessimage
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestSquares(t *testing.T) {
+	for s, want := range map[string][2]int{"a8": {0, 0}, "e2": {4, 6}, "H1": {7, 7}} {
+		sq, ok := ParseSquare(s)
+		if !ok || SquarePos(sq) != want {
+			t.Errorf("%s is at %v, %v, want %v", s, SquarePos(sq), ok, want)
+		}
+	}
+	for _, s := range []string{"", "i1", "a9", "e22"} {
+		if _, ok := ParseSquare(s); ok {
+			t.Errorf("ParseSquare(%q) succeeded", s)
+		}
+	}
+}
+
+func TestLastMoveMarks(t *testing.T) {
+	g := chess.NewGame(chess.UseNotation(chess.AlgebraicNotation{}))
+	for _, m := range []string{"e4", "f5", "Qh5"} {
+		if err := g.MoveStr(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	positions, moves := g.Positions(), g.Moves()
+	if marks := LastMoveMarks(moves[0], positions[1]); len(marks) != 1 || marks[0].Pos[0] != [2]int{4, 6} || marks[0].Pos[1] != [2]int{4, 4} {
+		t.Errorf("marks of e4 = %v, want e2e4 only", marks)
+	}
+	marks := LastMoveMarks(moves[2], positions[3])
+	if len(marks) != 2 || marks[1].Style != MarkCheck || marks[1].Pos[0] != [2]int{4, 0} {
+		t.Errorf("marks of Qh5+ = %v, want the black king on e8 checked", marks)
+	}
+}
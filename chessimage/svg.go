@@ -0,0 +1,267 @@
+package chessimage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// SVG writes the board as an svg document to w, it shares the layout and
+// marks with Draw and uses the glyph outlines from the pieces font so it
+// doesn't depend on fonts installed on the viewer.
+func (d *Drawer) SVG(w io.Writer, fen string, marks ...Mark) error {
+	size := d.size
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf,
+		`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%[1]d" height="%[1]d" viewBox="0 0 %[1]d %[1]d">`+"\n",
+		size,
+	)
+
+	// Glyph definitions
+	buf.WriteString("<defs>\n")
+	var sb sfnt.Buffer
+	for _, k := range "kqrbnp" {
+		r := piecesMap[k]
+		p, err := d.glyphPath(&sb, r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, `<path id="g%x" d="%s"/>`+"\n", r, p)
+	}
+	for i, m := range marks {
+		if m.Style != MarkCheck {
+			continue
+		}
+		hex, a := svgColor(m.Color)
+		fmt.Fprintf(buf,
+			`<radialGradient id="m%d"><stop offset="0" stop-color="%[2]s" stop-opacity="%[3]s"/><stop offset="0.5" stop-color="%[2]s" stop-opacity="%[4]s"/><stop offset="1" stop-color="%[2]s" stop-opacity="0"/></radialGradient>`+"\n",
+			i, hex, ftoa(a), ftoa(a*.75),
+		)
+	}
+	buf.WriteString("</defs>\n")
+
+	if !d.transparent {
+		fmt.Fprintf(buf, `<rect width="%d" height="%d" %s/>`+"\n", size, size, svgFill(mulColor(d.squareWhite, .9)))
+	}
+	for sy := 0; sy < 8; sy++ {
+		for sx := 0; sx < 8; sx++ {
+			fmt.Fprintf(buf, "%s %s/>\n", svgRect(d.squareRect(sx, sy)), svgFill(d.squareColor(sx, sy)))
+		}
+	}
+
+	for i, m := range marks {
+		if !m.overPieces() {
+			d.svgMark(buf, i, m)
+		}
+	}
+
+	var perr error
+	err := walkFen(fen, func(sx, sy int, p Piece, r rune) {
+		if d.pieces != nil {
+			href, err := d.svgPieceHref(pieceLetter(p, r))
+			if err != nil {
+				perr = err
+				return
+			}
+			r := d.squareRect(sx, sy)
+			fmt.Fprintf(buf, `<image x="%d" y="%d" width="%d" height="%d" %s/>`+"\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), href)
+			return
+		}
+		c := d.pieceWhite
+		border := d.pieceBlack
+		if p == PieceBlack {
+			c, border = border, mulColor(c, 0.7)
+		}
+		dot := d.pieceDot(sx, sy, r)
+		x, y := fixedf(dot.X), fixedf(dot.Y)
+		o := float32(d.outline)
+		use := `<use xlink:href="#g%x" x="%s" y="%s" %s/>` + "\n"
+		fmt.Fprintf(buf, use, r, ftoa(x-o), ftoa(y-o), svgFill(border))
+		fmt.Fprintf(buf, use, r, ftoa(x+o), ftoa(y+o), svgFill(border))
+		fmt.Fprintf(buf, use, r, ftoa(x), ftoa(y), svgFill(c))
+	})
+	if err == nil {
+		err = perr
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, m := range marks {
+		if m.overPieces() {
+			d.svgMark(buf, i, m)
+		}
+	}
+
+	// Rulers
+	d.rulers(func(dot fixed.Point26_6, s string) {
+		fmt.Fprintf(buf,
+			`<text x="%s" y="%s" font-family="FreeSerif, serif" font-size="%s">%s</text>`+"\n",
+			ftoa(fixedf(dot.X)), ftoa(fixedf(dot.Y)), ftoa(float32(d.textSize)), s,
+		)
+	})
+
+	buf.WriteString("</svg>\n")
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (d *Drawer) svgMark(buf *bytes.Buffer, i int, m Mark) {
+	s := d.square
+	switch m.Style {
+	case MarkArrow:
+		p := &svgPath{}
+		for i := 0; i+1 < len(m.Pos); i += 2 {
+			from, to := m.Pos[i], m.Pos[i+1]
+			arrowPath(
+				p,
+				d.squareCenter(from),
+				d.squareCenter(to),
+				knightJump(from, to),
+				float32(s)*m.width(),
+			)
+		}
+		fmt.Fprintf(buf, `<path d="%s" %s/>`+"\n", p, svgFill(m.Color))
+		return
+	}
+	for _, pos := range m.Pos {
+		c := d.squareCenter(pos)
+		switch m.Style {
+		case MarkDot:
+			fmt.Fprintf(buf, `<circle cx="%s" cy="%s" r="%s" %s/>`+"\n",
+				ftoa(c.x), ftoa(c.y), ftoa(float32(s)/6), svgFill(m.Color),
+			)
+		case MarkCircle:
+			w := float32(s) * m.width()
+			fmt.Fprintf(buf, `<circle cx="%s" cy="%s" r="%s" fill="none" stroke-width="%s" %s/>`+"\n",
+				ftoa(c.x), ftoa(c.y), ftoa((float32(s)-w)/2-w/2), ftoa(w), svgAttr("stroke", m.Color),
+			)
+		case MarkCheck:
+			fmt.Fprintf(buf, `<circle cx="%s" cy="%s" r="%s" fill="url(#m%d)"/>`+"\n",
+				ftoa(c.x), ftoa(c.y), ftoa(float32(s)/2), i,
+			)
+		default:
+			fmt.Fprintf(buf, "%s %s/>\n", svgRect(d.squareRect(pos[0], pos[1])), svgFill(m.Color))
+		}
+	}
+}
+
+// svgPieceHref returns the href attribute of an image element with the piece
+// set image for the fen letter p, svg sets are embedded as is.
+func (d *Drawer) svgPieceHref(p rune) (string, error) {
+	if fs, ok := d.pieces.(*fileSet); ok {
+		if data, ok := fs.svg(p); ok {
+			return `xlink:href="data:image/svg+xml;base64,` + base64.StdEncoding.EncodeToString(data) + `"`, nil
+		}
+	}
+	im, ok := d.pieceImages[p]
+	if !ok {
+		return "", fmt.Errorf("no image for piece %c", p)
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, im); err != nil {
+		return "", err
+	}
+	return `xlink:href="data:image/png;base64,` + base64.StdEncoding.EncodeToString(buf.Bytes()) + `"`, nil
+}
+
+// glyphPath returns the svg path data of the glyph for r in the pieces font
+// with the origin at the glyph's dot.
+func (d *Drawer) glyphPath(b *sfnt.Buffer, r rune) (string, error) {
+	idx, err := d.font.GlyphIndex(b, r)
+	if err != nil {
+		return "", err
+	}
+	segs, err := d.font.LoadGlyph(b, idx, fixed.Int26_6(d.pieceSize*64), nil)
+	if err != nil {
+		return "", err
+	}
+	p := &svgPath{}
+	f := fixedf
+	for i, sg := range segs {
+		a := sg.Args
+		switch sg.Op {
+		case sfnt.SegmentOpMoveTo:
+			if i != 0 {
+				p.ClosePath()
+			}
+			p.MoveTo(f(a[0].X), f(a[0].Y))
+		case sfnt.SegmentOpLineTo:
+			p.LineTo(f(a[0].X), f(a[0].Y))
+		case sfnt.SegmentOpQuadTo:
+			p.QuadTo(f(a[0].X), f(a[0].Y), f(a[1].X), f(a[1].Y))
+		case sfnt.SegmentOpCubeTo:
+			p.CubeTo(f(a[0].X), f(a[0].Y), f(a[1].X), f(a[1].Y), f(a[2].X), f(a[2].Y))
+		}
+	}
+	if len(segs) != 0 {
+		p.ClosePath()
+	}
+	return p.String(), nil
+}
+
+// svgPath builds svg path data, it implements pather.
+type svgPath struct {
+	bytes.Buffer
+}
+
+func (p *svgPath) cmd(c byte, args ...float32) {
+	if p.Len() != 0 {
+		p.WriteByte(' ')
+	}
+	p.WriteByte(c)
+	for _, a := range args {
+		p.WriteByte(' ')
+		p.WriteString(ftoa(a))
+	}
+}
+
+func (p *svgPath) MoveTo(ax, ay float32)                 { p.cmd('M', ax, ay) }
+func (p *svgPath) LineTo(bx, by float32)                 { p.cmd('L', bx, by) }
+func (p *svgPath) QuadTo(bx, by, cx, cy float32)         { p.cmd('Q', bx, by, cx, cy) }
+func (p *svgPath) CubeTo(bx, by, cx, cy, dx, dy float32) { p.cmd('C', bx, by, cx, cy, dx, dy) }
+func (p *svgPath) ClosePath()                            { p.cmd('Z') }
+
+// svgRect returns an unclosed rect element for r.
+func svgRect(r image.Rectangle) string {
+	return fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d"`, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+}
+
+func fixedf(v fixed.Int26_6) float32 {
+	return float32(v) / 64
+}
+
+func ftoa(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+func svgFill(c color.Color) string {
+	return svgAttr("fill", c)
+}
+
+// svgAttr returns the attribute and its opacity for color c.
+func svgAttr(attr string, c color.Color) string {
+	hex, a := svgColor(c)
+	s := fmt.Sprintf(`%s="%s"`, attr, hex)
+	if a != 1 {
+		s += fmt.Sprintf(` %s-opacity="%s"`, attr, ftoa(a))
+	}
+	return s
+}
+
+// svgColor returns the hex notation and the opacity of c.
+func svgColor(c color.Color) (string, float32) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	a := float32(math.Round(float64(n.A)/0xff*1000) / 1000)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B), a
+}
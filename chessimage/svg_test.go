@@ -0,0 +1,106 @@
+package chessimage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// pieceSVG is a minimal valid piece, a filled square.
+const pieceSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 45 45"><rect width="45" height="45" fill="#f00"/></svg>`
+
+func writeSVGs(t *testing.T, dir string) {
+	t.Helper()
+	for _, name := range pieceNames {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".svg"), []byte(pieceSVG), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkXML decodes the whole document and counts its elements by name.
+func checkXML(t *testing.T, data []byte) map[string]int {
+	t.Helper()
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	count := map[string]int{}
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid svg: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			count[tok.Name.Local]++
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if depth != 0 || count["svg"] != 1 {
+		t.Fatalf("svg has %d unclosed elements and %d roots", depth, count["svg"])
+	}
+	return count
+}
+
+func TestSVG(t *testing.T) {
+	c := color.NRGBA{20, 140, 60, 180}
+	marks := []Mark{
+		{Color: c, Pos: [][2]int{{4, 6}, {4, 4}}},
+		{Style: MarkDot, Color: c, Pos: [][2]int{{4, 5}}},
+		{Style: MarkCheck, Color: color.RGBA{220, 30, 30, 255}, Pos: [][2]int{{4, 7}}},
+		{Style: MarkArrow, Color: c, Pos: [][2]int{{6, 7}, {5, 5}, {3, 6}, {3, 4}}},
+		{Style: MarkCircle, Color: c, Pos: [][2]int{{3, 3}}, Width: 0.08},
+	}
+
+	dir := t.TempDir()
+	writeSVGs(t, dir)
+	set, err := LoadPieceSet(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts []func(d *Drawer)
+		// element is the one drawing each piece
+		element string
+	}{
+		{name: "glyphs", element: "use"},
+		{name: "flipped transparent", opts: []func(d *Drawer){WithFlip(), WithTransparentBackground()}, element: "use"},
+		{name: "piece set", opts: []func(d *Drawer){WithTheme(Theme{Name: "set", Pieces: set})}, element: "image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDrawer(tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			buf := &bytes.Buffer{}
+			if err := d.SVG(buf, startFEN, marks...); err != nil {
+				t.Fatal(err)
+			}
+			count := checkXML(t, buf.Bytes())
+			pieces := count[tt.element]
+			if tt.element == "use" {
+				// each glyph is drawn with two outline copies
+				pieces /= 3
+			}
+			if pieces != 32 {
+				t.Errorf("%d pieces drawn with <%s>, want 32", pieces, tt.element)
+			}
+			if count["radialGradient"] != 1 || count["text"] != 16 {
+				t.Errorf("elements = %v, want a check gradient and 16 rulers", count)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package chessimage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "image/png"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	xdraw "golang.org/x/image/draw"
+)
+
+// Theme is a named set of board colors with an optional piece set.
+type Theme struct {
+	Name        string
+	SquareWhite color.Color
+	SquareBlack color.Color
+	PieceWhite  color.Color
+	PieceBlack  color.Color
+	// Pieces replaces the font glyphs if not nil.
+	Pieces PieceSet
+}
+
+// Themes built in the package, "classic" is the drawer default.
+var builtinThemes = []Theme{
+	{
+		Name:        "classic",
+		SquareWhite: color.RGBA{200, 200, 200, 255},
+		SquareBlack: color.RGBA{100, 100, 120, 255},
+		PieceWhite:  color.White,
+		PieceBlack:  color.Black,
+	},
+	{
+		Name:        "wood",
+		SquareWhite: color.RGBA{240, 217, 181, 255},
+		SquareBlack: color.RGBA{181, 136, 99, 255},
+		PieceWhite:  color.RGBA{255, 250, 240, 255},
+		PieceBlack:  color.RGBA{40, 25, 15, 255},
+	},
+	{
+		Name:        "green",
+		SquareWhite: color.RGBA{238, 238, 210, 255},
+		SquareBlack: color.RGBA{118, 150, 86, 255},
+		PieceWhite:  color.White,
+		PieceBlack:  color.Black,
+	},
+	{
+		Name:        "blue",
+		SquareWhite: color.RGBA{222, 227, 230, 255},
+		SquareBlack: color.RGBA{140, 162, 173, 255},
+		PieceWhite:  color.White,
+		PieceBlack:  color.RGBA{20, 30, 45, 255},
+	},
+	{
+		Name:        "high-contrast",
+		SquareWhite: color.White,
+		SquareBlack: color.RGBA{70, 70, 70, 255},
+		PieceWhite:  color.White,
+		PieceBlack:  color.Black,
+	},
+}
+
+// ThemeByName returns the built in theme with the given name.
+func ThemeByName(name string) (Theme, bool) {
+	for _, t := range builtinThemes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Theme{}, false
+}
+
+// ThemeNames returns the names of the built in themes.
+func ThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for _, t := range builtinThemes {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// WithTheme sets the drawer colors and pieces from t.
+func WithTheme(t Theme) func(d *Drawer) {
+	return func(d *Drawer) {
+		if t.SquareWhite != nil && t.SquareBlack != nil {
+			WithSquareColors(t.SquareWhite, t.SquareBlack)(d)
+		}
+		if t.PieceWhite != nil && t.PieceBlack != nil {
+			WithPieceColors(t.PieceWhite, t.PieceBlack)(d)
+		}
+		d.pieces = t.Pieces
+	}
+}
+
+// PieceSet provides piece images to be used instead of the font glyphs.
+type PieceSet interface {
+	// Piece returns the image of the piece p, a fen letter i.e: 'K' or 'p',
+	// scaled to size x size pixels.
+	Piece(p rune, size int) (image.Image, error)
+}
+
+// pieceNames maps fen letters to the file names of the pieces in a set
+// directory, it uses the common "wK.svg" naming.
+var pieceNames = map[rune]string{
+	'K': "wK", 'Q': "wQ", 'R': "wR", 'B': "wB", 'N': "wN", 'P': "wP",
+	'k': "bK", 'q': "bQ", 'r': "bR", 'b': "bB", 'n': "bN", 'p': "bP",
+}
+
+// spriteOrder is the column order of pieces in a sprite sheet, white pieces
+// on the first row and black on the second.
+const spriteOrder = "KQBNRP"
+
+// LoadPieceSet loads a piece set from dir, the directory either contains a
+// file per piece named like "wK.svg" or "bN.png", or a single "sprite.png"
+// with the pieces in the order "KQBNRP", white on the top row and black in
+// the bottom row.
+func LoadPieceSet(dir string) (PieceSet, error) {
+	sprite := filepath.Join(dir, "sprite.png")
+	if _, err := os.Stat(sprite); err == nil {
+		return loadSprite(sprite)
+	}
+
+	set := &fileSet{
+		svgs:   map[rune][]byte{},
+		images: map[rune]image.Image{},
+	}
+	for p, name := range pieceNames {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, name+".svg")); err == nil {
+			if _, err := oksvg.ReadIconStream(bytes.NewReader(data)); err != nil {
+				return nil, fmt.Errorf("%s.svg: %w", name, err)
+			}
+			set.svgs[p] = data
+			continue
+		}
+		im, err := decodeImage(filepath.Join(dir, name+".png"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("missing piece %s in %s", name, dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		set.images[p] = im
+	}
+	return set, nil
+}
+
+// LoadThemes loads a theme with the classic colors for each piece set
+// directory in dir, themes are named after the directories.
+func LoadThemes(dir string) ([]Theme, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	classic, _ := ThemeByName("classic")
+
+	themes := []Theme{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		set, err := LoadPieceSet(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		t := classic
+		t.Name = strings.ToLower(e.Name())
+		t.Pieces = set
+		themes = append(themes, t)
+	}
+	sort.Slice(themes, func(i, j int) bool { return themes[i].Name < themes[j].Name })
+	return themes, nil
+}
+
+func loadSprite(path string) (PieceSet, error) {
+	im, err := decodeImage(path)
+	if err != nil {
+		return nil, err
+	}
+	b := im.Bounds()
+	w, h := b.Dx()/len(spriteOrder), b.Dy()/2
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("sprite %s is too small", path)
+	}
+
+	set := &fileSet{images: map[rune]image.Image{}}
+	for i, p := range spriteOrder {
+		for row, r := range []rune{p, p + 'a' - 'A'} {
+			cell := image.Rect(i*w, row*h, (i+1)*w, (row+1)*h).Add(b.Min)
+			dst := image.NewRGBA(image.Rect(0, 0, w, h))
+			draw.Draw(dst, dst.Bounds(), im, cell.Min, draw.Src)
+			set.images[r] = dst
+		}
+	}
+	return set, nil
+}
+
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	im, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return im, nil
+}
+
+// fileSet is a piece set loaded from svg or raster files.
+type fileSet struct {
+	svgs   map[rune][]byte
+	images map[rune]image.Image
+}
+
+func (s *fileSet) Piece(p rune, size int) (image.Image, error) {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	if data, ok := s.svgs[p]; ok {
+		icon, err := oksvg.ReadIconStream(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		icon.SetTarget(0, 0, float64(size), float64(size))
+		scanner := rasterx.NewScannerGV(size, size, dst, dst.Bounds())
+		icon.Draw(rasterx.NewDasher(size, size, scanner), 1)
+		return dst, nil
+	}
+	im, ok := s.images[p]
+	if !ok {
+		return nil, fmt.Errorf("no image for piece %c", p)
+	}
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), im, im.Bounds(), draw.Over, nil)
+	return dst, nil
+}
+
+// svg returns the svg source of piece p if the set was loaded from svg
+// files.
+func (s *fileSet) svg(p rune) ([]byte, bool) {
+	data, ok := s.svgs[p]
+	return data, ok
+}
@@ -0,0 +1,121 @@
+package chessimage
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePNG(t *testing.T, path string, im image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, im); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadPieceSet(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string)
+		// svg reports whether the set keeps the svg sources
+		svg bool
+		err string
+	}{
+		{
+			name:  "svg files",
+			setup: writeSVGs,
+			svg:   true,
+		},
+		{
+			name: "png files",
+			setup: func(t *testing.T, dir string) {
+				for _, name := range pieceNames {
+					im := image.NewRGBA(image.Rect(0, 0, 10, 10))
+					for i := range im.Pix {
+						im.Pix[i] = 255
+						if i%4 == 1 || i%4 == 2 {
+							im.Pix[i] = 0
+						}
+					}
+					writePNG(t, filepath.Join(dir, name+".png"), im)
+				}
+			},
+		},
+		{
+			name: "sprite",
+			setup: func(t *testing.T, dir string) {
+				im := image.NewRGBA(image.Rect(0, 0, 60, 20))
+				for y := 0; y < 20; y++ {
+					for x := 0; x < 60; x++ {
+						im.Set(x, y, red)
+					}
+				}
+				writePNG(t, filepath.Join(dir, "sprite.png"), im)
+			},
+		},
+		{
+			name: "missing piece",
+			setup: func(t *testing.T, dir string) {
+				ioutil.WriteFile(filepath.Join(dir, "wK.svg"), []byte(pieceSVG), 0o644)
+			},
+			err: "missing piece",
+		},
+		{
+			name: "invalid svg",
+			setup: func(t *testing.T, dir string) {
+				writeSVGs(t, dir)
+				ioutil.WriteFile(filepath.Join(dir, "wK.svg"), []byte("<svg"), 0o644)
+			},
+			err: "wK.svg",
+		},
+		{
+			name: "sprite too small",
+			setup: func(t *testing.T, dir string) {
+				writePNG(t, filepath.Join(dir, "sprite.png"), image.NewRGBA(image.Rect(0, 0, 5, 1)))
+			},
+			err: "too small",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+			set, err := LoadPieceSet(dir)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := set.(*fileSet).svg('K'); ok != tt.svg {
+				t.Errorf("svg source kept = %v, want %v", ok, tt.svg)
+			}
+			for _, p := range "KQRBNPkqrbnp" {
+				im, err := set.Piece(p, 32)
+				if err != nil {
+					t.Fatalf("piece %c: %v", p, err)
+				}
+				if b := im.Bounds(); b.Dx() != 32 || b.Dy() != 32 {
+					t.Errorf("piece %c is %v, want 32x32", p, b)
+				}
+				if r, g, _, a := im.At(16, 16).RGBA(); r>>8 != 255 || g != 0 || a>>8 != 255 {
+					t.Errorf("piece %c center = %v, want red", p, im.At(16, 16))
+				}
+			}
+		})
+	}
+}
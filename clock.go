@@ -0,0 +1,98 @@
+package discordchess
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// timeControl is the time of each player and the increment added after
+// each move, games are untimed if Base is zero.
+type timeControl struct {
+	Base      time.Duration
+	Increment time.Duration
+}
+
+// parseTimeControl parses "<minutes>+<seconds>" i.e: "10+5", "none" or an
+// empty string are untimed.
+func parseTimeControl(s string) (timeControl, error) {
+	if s == "" || s == "none" {
+		return timeControl{}, nil
+	}
+	invalid := GameError(fmt.Sprintf("Invalid time control %q, use `<minutes>+<increment seconds>` i.e: `10+5` or `none`", s))
+	parts := strings.SplitN(s, "+", 2)
+	min, err := strconv.Atoi(parts[0])
+	if err != nil || min <= 0 {
+		return timeControl{}, invalid
+	}
+	tc := timeControl{Base: time.Duration(min) * time.Minute}
+	if len(parts) == 2 {
+		inc, err := strconv.Atoi(parts[1])
+		if err != nil || inc < 0 {
+			return timeControl{}, invalid
+		}
+		tc.Increment = time.Duration(inc) * time.Second
+	}
+	return tc, nil
+}
+
+func (tc timeControl) String() string {
+	if tc.Base == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d+%d", int(tc.Base.Minutes()), int(tc.Increment.Seconds()))
+}
+
+// clock tracks the time left of each player.
+type clock struct {
+	tc   timeControl
+	left map[chess.Color]time.Duration
+	// turnStart is when the player to move started thinking, the clock
+	// doesn't run until the first board is sent
+	turnStart time.Time
+}
+
+func newClock(tc timeControl) *clock {
+	return &clock{
+		tc: tc,
+		left: map[chess.Color]time.Duration{
+			chess.White: tc.Base,
+			chess.Black: tc.Base,
+		},
+	}
+}
+
+// start starts the clock of the player to move if it isn't running.
+func (cl *clock) start(now time.Time) {
+	if cl.turnStart.IsZero() {
+		cl.turnStart = now
+	}
+}
+
+// remaining returns the time left of c at now if it is to move.
+func (cl *clock) remaining(c chess.Color, toMove chess.Color, now time.Time) time.Duration {
+	if c != toMove || cl.turnStart.IsZero() {
+		return cl.left[c]
+	}
+	return cl.left[c] - now.Sub(cl.turnStart)
+}
+
+// punch stops the clock of c after its move and starts the other one.
+func (cl *clock) punch(c chess.Color, now time.Time) {
+	cl.start(now)
+	cl.left[c] -= now.Sub(cl.turnStart)
+	cl.left[c] += cl.tc.Increment
+	cl.turnStart = now
+}
+
+// formatClock formats d as "m:ss".
+func formatClock(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	s := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
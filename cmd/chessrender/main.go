@@ -0,0 +1,233 @@
+// Command chessrender draws a chess position or a game to a png, gif or
+// svg file.
+//
+// The game is read from a pgn file, a move list or both from a fen, i.e:
+//
+//	chessrender -moves "e4 e5 Nf3" -o board.png
+//	chessrender -pgn game.pgn -o game.gif
+//	chessrender -fen "8/8/8/4k3/8/8/8/4K2R w K - 0 1" -arrows e1g1,h1f1 -o castle.svg
+//
+// Still images show the last position, or the one after -ply, gifs play
+// the whole game.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/notnil/chess"
+)
+
+func main() {
+	var (
+		fen         = flag.String("fen", "", "starting position, the standard one if empty")
+		pgnFile     = flag.String("pgn", "", `pgn file of the game, "-" reads stdin`)
+		moveList    = flag.String("moves", "", "moves played from the starting position, in algebraic or uci notation")
+		out         = flag.String("o", "", `output file, "-" writes stdout`)
+		format      = flag.String("format", "", "png, gif or svg, from the output file extension if empty")
+		size        = flag.Int("size", chessimage.DefaultSize, "image size in pixels")
+		theme       = flag.String("theme", "classic", "board theme")
+		themesDir   = flag.String("themes", "", "directory of piece sets, each sub directory is a theme")
+		orientation = flag.String("orientation", "white", "side at the bottom, white or black")
+		lastMove    = flag.Bool("last-move", true, "highlight the last move and the king in check")
+		arrows      = flag.String("arrows", "", "arrows e2e4 and circled squares e4, separated by commas or spaces")
+		ply         = flag.Int("ply", -1, "draw the position after this many half moves instead of the last one")
+		delay       = flag.Int("delay", 100, "gif delay between moves in 100ths of a second")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+
+	if *out == "" {
+		log.Fatal("missing -o, the output file")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*out)), ".")
+	}
+	if *format != "png" && *format != "gif" && *format != "svg" {
+		log.Fatalf("unknown format %q, use png, gif or svg", *format)
+	}
+
+	var pgn io.Reader
+	switch *pgnFile {
+	case "":
+	case "-":
+		pgn = os.Stdin
+	default:
+		f, err := os.Open(*pgnFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		pgn = f
+	}
+	g, err := loadGame(*fen, pgn, *moveList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	frames := gameFrames(g, *lastMove)
+	if *ply >= 0 {
+		if *ply >= len(frames) {
+			log.Fatalf("-ply %d is past the end of the game, it has %d half moves", *ply, len(frames)-1)
+		}
+		frames = frames[:*ply+1]
+	}
+	marks, err := parseMarks(*arrows)
+	if err != nil {
+		log.Fatal(err)
+	}
+	last := &frames[len(frames)-1]
+	last.Marks = append(last.Marks, marks...)
+
+	if *size < chessimage.MinSize || *size > chessimage.MaxSize {
+		log.Fatalf("invalid size %d, use %d to %d", *size, chessimage.MinSize, chessimage.MaxSize)
+	}
+	opts := []func(d *chessimage.Drawer){chessimage.WithSize(*size)}
+	t, err := findTheme(*theme, *themesDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts = append(opts, chessimage.WithTheme(t))
+	switch *orientation {
+	case "white":
+	case "black":
+		opts = append(opts, chessimage.WithFlip())
+	default:
+		log.Fatalf("unknown orientation %q, use white or black", *orientation)
+	}
+	d, err := chessimage.NewDrawer(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer d.Close()
+
+	buf := &bytes.Buffer{}
+	if err := render(buf, d, *format, frames, *delay); err != nil {
+		log.Fatal(err)
+	}
+	if *out == "-" {
+		_, err = buf.WriteTo(os.Stdout)
+	} else {
+		err = ioutil.WriteFile(*out, buf.Bytes(), 0o644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// render writes the last frame as png or svg, or all the frames as gif.
+func render(w io.Writer, d *chessimage.Drawer, format string, frames []chessimage.Frame, delay int) error {
+	last := frames[len(frames)-1]
+	switch format {
+	case "gif":
+		return d.EncodeGIF(w, frames, chessimage.GIFOptions{Delay: delay, LastDelay: 3 * delay})
+	case "svg":
+		return d.SVG(w, last.FEN, last.Marks...)
+	default:
+		im, err := d.Image(last.FEN, last.Marks...)
+		if err != nil {
+			return err
+		}
+		return png.Encode(w, im)
+	}
+}
+
+// findTheme returns the built in theme or the one loaded from dir.
+func findTheme(name, dir string) (chessimage.Theme, error) {
+	names := chessimage.ThemeNames()
+	if dir != "" {
+		themes, err := chessimage.LoadThemes(dir)
+		if err != nil {
+			return chessimage.Theme{}, err
+		}
+		for _, t := range themes {
+			if t.Name == name {
+				return t, nil
+			}
+			names = append(names, t.Name)
+		}
+	}
+	if t, ok := chessimage.ThemeByName(name); ok {
+		return t, nil
+	}
+	return chessimage.Theme{}, fmt.Errorf("unknown theme %q, available: %s", name, strings.Join(names, ", "))
+}
+
+// moveNumberRE matches the move numbers of a move list, i.e: "12." "12...".
+var moveNumberRE = regexp.MustCompile(`^\d+\.+`)
+
+// loadGame plays the pgn if not nil then the moves from fen or the standard
+// position.
+func loadGame(fen string, pgn io.Reader, moves string) (*chess.Game, error) {
+	opts := []func(*chess.Game){}
+	if fen != "" {
+		opt, err := chess.FEN(fen)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fen: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	if pgn != nil {
+		if fen != "" {
+			return nil, errors.New("-fen and -pgn can't be used together, put the fen in a FEN tag")
+		}
+		opt, err := chess.PGN(pgn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pgn: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	g := chess.NewGame(opts...)
+
+	for _, s := range strings.Fields(moves) {
+		if s = moveNumberRE.ReplaceAllString(s, ""); s == "" {
+			continue
+		}
+		m, err := chess.AlgebraicNotation{}.Decode(g.Position(), s)
+		if err != nil {
+			m, err = chess.UCINotation{}.Decode(g.Position(), s)
+		}
+		if err == nil {
+			err = g.Move(m)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid move %q after %d half moves", s, len(g.Moves()))
+		}
+	}
+	return g, nil
+}
+
+// gameFrames returns a frame per position of g, the moves are highlighted
+// if lastMove.
+func gameFrames(g *chess.Game, lastMove bool) []chessimage.Frame {
+	positions := g.Positions()
+	frames := []chessimage.Frame{{FEN: positions[0].String()}}
+	for i, m := range g.Moves() {
+		pos := positions[i+1]
+		f := chessimage.Frame{
+			FEN:  pos.String(),
+			Move: [][2]int{chessimage.SquarePos(m.S1()), chessimage.SquarePos(m.S2())},
+		}
+		if lastMove {
+			f.Marks = chessimage.LastMoveMarks(m, pos)
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// parseMarks parses the arrows "e2e4" and circles "e4" separated by commas
+// or spaces.
+func parseMarks(s string) ([]chessimage.Mark, error) {
+	return chessimage.ParseAnnotations(strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+)
+
+const scholarsMate = `[Event "test"]
+[Result "1-0"]
+
+1. e4 e5 2. Qh5 Nc6 3. Bc4 Nf6 4. Qxf7# 1-0
+`
+
+func TestLoadGame(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		pgn   string
+		moves string
+		want  string
+		err   string
+	}{
+		{name: "start", want: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"},
+		{
+			name:  "moves",
+			moves: "1. e4 e5 2.Nf3 g8f6",
+			want:  "rnbqkb1r/pppp1ppp/5n2/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3",
+		},
+		{
+			name: "pgn",
+			pgn:  scholarsMate,
+			want: "r1bqkb1r/pppp1Qpp/2n2n2/4p3/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 0 4",
+		},
+		{
+			name:  "fen and moves",
+			fen:   "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1",
+			moves: "e4 Kd7",
+			want:  "8/3k4/8/8/4P3/8/8/4K3 w - - 1 2",
+		},
+		{name: "invalid move", moves: "e4 e4", err: `invalid move "e4" after 1 half moves`},
+		{name: "invalid fen", fen: "nope", err: "invalid fen"},
+		{name: "fen and pgn", fen: "8/8/8/4k3/8/8/8/4K2R w K - 0 1", pgn: scholarsMate, err: "can't be used together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pgn io.Reader
+			if tt.pgn != "" {
+				pgn = strings.NewReader(tt.pgn)
+			}
+			g, err := loadGame(tt.fen, pgn, tt.moves)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := g.Position().String(); got != tt.want {
+				t.Errorf("fen = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMarks(t *testing.T) {
+	marks, err := parseMarks("e2e4, g1f3 d5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arrows := marks[0].Pos; len(arrows) != 4 || arrows[0] != [2]int{4, 6} || arrows[1] != [2]int{4, 4} {
+		t.Errorf("arrows = %v", arrows)
+	}
+	if circles := marks[1].Pos; len(circles) != 1 || circles[0] != [2]int{3, 3} {
+		t.Errorf("circles = %v", circles)
+	}
+	for _, s := range []string{"e2e2", "i1", "e2e"} {
+		if _, err := parseMarks(s); err == nil {
+			t.Errorf("parseMarks(%q) succeeded", s)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	g, err := loadGame("", strings.NewReader(scholarsMate), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := gameFrames(g, true)
+	if len(frames) != 8 || len(frames[7].Marks) != 2 || frames[7].Marks[1].Style != chessimage.MarkCheck {
+		t.Fatalf("frames = %+v, want the last move and the check marked", frames[len(frames)-1])
+	}
+	if f := gameFrames(g, false); len(f[7].Marks) != 0 {
+		t.Errorf("marks without the last move = %v", f[7].Marks)
+	}
+
+	d, err := chessimage.NewDrawer(chessimage.WithSize(256), chessimage.WithFlip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	buf := &bytes.Buffer{}
+	if err := render(buf, d, "png", frames, 100); err != nil {
+		t.Fatal(err)
+	}
+	if im, err := png.Decode(buf); err != nil || im.Bounds().Dx() != 256 {
+		t.Errorf("png = %v, %v", im, err)
+	}
+
+	buf.Reset()
+	if err := render(buf, d, "gif", frames, 50); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(frames) || anim.Delay[0] != 50 {
+		t.Errorf("gif has %d frames with delay %d, want %d with 50", len(anim.Image), anim.Delay[0], len(frames))
+	}
+
+	buf.Reset()
+	if err := render(buf, d, "svg", frames, 100); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "<svg") {
+		t.Errorf("svg = %.40q", buf.String())
+	}
+}
@@ -0,0 +1,119 @@
+// Command discordchess-cli runs the chess commands in a terminal without a
+// discord connection.
+//
+// Each line typed is sent as a message from the fake user, mentions are
+// written as @name, i.e: "!play @me @bot". The line "/user name" switches
+// the author of the following messages, the initial user owns the fake
+// server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DiscordGophers/discordchess"
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/bwmarrin/discordgo"
+	"github.com/notnil/chess"
+)
+
+func main() {
+	var (
+		user   = flag.String("user", "me", "ID of the user sending the messages")
+		prefix = flag.String("prefix", "!", "command prefix")
+		out    = flag.String("out", "", "directory to write the images to, boards are printed as text if empty")
+		engine = flag.String("engine", "stockfish", `uci engine path for games against @bot, "stub" plays random moves`)
+	)
+	flag.Parse()
+
+	opts := []func(c *discordchess.ChessHandler){
+		discordchess.WithTextBoard(*out == ""),
+	}
+	if *engine == "stub" {
+		opts = append(opts, discordchess.WithEngine(func(int) (discordchess.Engine, error) {
+			return randomEngine{rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+		}))
+	} else {
+		path := *engine
+		opts = append(opts, discordchess.WithEngine(func(level int) (discordchess.Engine, error) {
+			return discordchess.NewUCIEngine(path, level, nil)
+		}))
+	}
+
+	dc, err := discordchess.New(*prefix, "", nil, opts...)
+	if err != nil {
+		log.Fatalf("Failed to create discordchess handler: %v", err)
+	}
+
+	if *out != "" {
+		if err := os.MkdirAll(*out, 0o755); err != nil {
+			log.Fatalf("Failed to create output directory: %v", err)
+		}
+	}
+	s := &session{out: *out, w: os.Stdout, owner: *user}
+
+	author := *user
+	sc := bufio.NewScanner(os.Stdin)
+	for id := 1; ; id++ {
+		fmt.Printf("%s> ", author)
+		if !sc.Scan() {
+			break
+		}
+		line := strings.TrimSpace(sc.Text())
+		if f := strings.Fields(line); len(f) == 2 && f[0] == "/user" {
+			author = f[1]
+			continue
+		}
+		dc.HandleMessage(s, message(strconv.Itoa(id), author, line))
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+	// closes the engines
+	if err := dc.Shutdown(context.Background(), s); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var mentionRE = regexp.MustCompile(`@(\w+)`)
+
+// message builds the message typed by author, @name mentions are turned into
+// discord mentions.
+func message(id, author, line string) *discordgo.MessageCreate {
+	m := &discordgo.Message{
+		ID:        id,
+		ChannelID: channelID,
+		GuildID:   "cli",
+		Author:    &discordgo.User{ID: author, Username: author},
+		Member:    &discordgo.Member{},
+	}
+	m.Content = mentionRE.ReplaceAllStringFunc(line, func(s string) string {
+		m.Mentions = append(m.Mentions, &discordgo.User{ID: s[1:], Username: s[1:]})
+		return "<" + s + ">"
+	})
+	return &discordgo.MessageCreate{Message: m}
+}
+
+// randomEngine plays random legal moves.
+type randomEngine struct {
+	rnd *rand.Rand
+}
+
+func (e randomEngine) Search(pos *chess.Position, _ time.Duration) (*chess.Move, chessimage.Eval, error) {
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		return nil, chessimage.Eval{}, fmt.Errorf("no legal moves")
+	}
+	return moves[e.rnd.Intn(len(moves))], chessimage.Eval{}, nil
+}
+
+func (randomEngine) Close() error { return nil }
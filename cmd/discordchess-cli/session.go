@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	channelID   = "terminal"
+	dmChannelID = "direct"
+	botID       = "bot"
+)
+
+// session prints the messages to w and writes the files in out, owner owns
+// the fake guild so it can run the admin commands.
+type session struct {
+	out   string
+	w     io.Writer
+	owner string
+
+	// mu guards w and files, the clock timers send from their goroutines
+	mu    sync.Mutex
+	files int
+}
+
+func (s *session) ChannelMessageSend(id, content string) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == dmChannelID {
+		content = "[direct message] " + content
+	}
+	fmt.Fprintln(s.w, content)
+	return &discordgo.Message{Content: content}, nil
+}
+
+func (s *session) ChannelMessageSendReply(_, content string, _ *discordgo.MessageReference) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.w, "↳", content)
+	return &discordgo.Message{Content: content}, nil
+}
+
+func (s *session) ChannelMessageSendEmbed(_ string, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "== %s: %s\n", embed.Title, embed.Description)
+	for _, f := range embed.Fields {
+		fmt.Fprintf(s.w, "   %s %s\n", f.Name, strings.TrimSpace(f.Value))
+	}
+	return &discordgo.Message{}, nil
+}
+
+func (s *session) ChannelFileSend(_, name string, r io.Reader) (*discordgo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == "" {
+		n, err := io.Copy(ioutil.Discard, r)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(s.w, "[%s, %d bytes, use -out to save the files]\n", name, n)
+		return &discordgo.Message{}, nil
+	}
+
+	s.files++
+	path := filepath.Join(s.out, fmt.Sprintf("%03d-%s", s.files, name))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(s.w, "[%s]\n", path)
+	return &discordgo.Message{}, nil
+}
+
+func (s *session) MessageReactionAdd(_, _, emojiID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.w, emojiID)
+	return nil
+}
+
+func (s *session) User(userID string) (*discordgo.User, error) {
+	return &discordgo.User{ID: userID, Username: userID}, nil
+}
+
+func (s *session) UserAvatarDecode(*discordgo.User) (image.Image, error) {
+	return nil, nil
+}
+
+func (s *session) Channel(channelID string) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: channelID, Name: channelID}, nil
+}
+
+func (s *session) Guild(guildID string) (*discordgo.Guild, error) {
+	return &discordgo.Guild{ID: guildID, OwnerID: s.owner}, nil
+}
+
+func (s *session) UserChannelCreate(string) (*discordgo.Channel, error) {
+	return &discordgo.Channel{ID: dmChannelID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (s *session) BotID() string {
+	return botID
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/DiscordGophers/discordchess"
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"gopkg.in/yaml.v3"
+)
+
+// config is the bot configuration, read from a yaml file and overridden by
+// the environment, see envOverrides for the settings that can be.
+type config struct {
+	Token struct {
+		// Value is the token itself, File a file containing it, i.e: a
+		// docker secret, and Env the variable holding it.
+		Value string `yaml:"value"`
+		File  string `yaml:"file"`
+		Env   string `yaml:"env"`
+	} `yaml:"token"`
+
+	Prefix string `yaml:"prefix"`
+	// Rooms matches the names of the channels where games can be played,
+	// ".*" allows every channel.
+	Rooms string `yaml:"rooms"`
+	// AdminRoles are "guildID:roleID" pairs.
+	AdminRoles []string `yaml:"admin_roles"`
+
+	Engine struct {
+		Path    string            `yaml:"path"`
+		Options map[string]string `yaml:"options"`
+	} `yaml:"engine"`
+
+	Render struct {
+		// Theme is the default theme, ThemesDir a directory with a piece
+		// set per sub directory.
+		Theme     string `yaml:"theme"`
+		ThemesDir string `yaml:"themes_dir"`
+		// GIFMaxBytes is the size budget of the replays.
+		GIFMaxBytes int `yaml:"gif_max_bytes"`
+	} `yaml:"render"`
+
+	Storage struct {
+		Guilds  string `yaml:"guilds"`
+		Audit   string `yaml:"audit"`
+		Games   string `yaml:"games"`
+		Players string `yaml:"players"`
+		Prefs   string `yaml:"prefs"`
+		// DeadLetters keeps the webhook deliveries that failed every
+		// attempt.
+		DeadLetters string `yaml:"dead_letters"`
+	} `yaml:"storage"`
+
+	HTTP struct {
+		Addr string `yaml:"addr"`
+		// Spectate serves the spectator pages under /watch/ and the
+		// overlays under /overlay/.
+		Spectate bool `yaml:"spectate"`
+		// API serves the json api under /games and /players.
+		API bool `yaml:"api"`
+	} `yaml:"http"`
+
+	// RateLimits are token buckets per user and per channel, a zero rate
+	// disables them, Costs overrides the tokens taken by a command.
+	RateLimits struct {
+		User    rateLimit          `yaml:"user"`
+		Channel rateLimit          `yaml:"channel"`
+		Costs   map[string]float64 `yaml:"costs"`
+	} `yaml:"rate_limits"`
+}
+
+// rateLimit is a bucket of burst tokens refilled at rate per second.
+type rateLimit struct {
+	Burst float64 `yaml:"burst"`
+	Rate  float64 `yaml:"rate"`
+}
+
+// defaultConfig returns the configuration used when there is no file.
+func defaultConfig() config {
+	cfg := config{Prefix: "!"}
+	cfg.Token.Env = "DISCORD_API_KEY"
+	cfg.Engine.Path = "stockfish"
+	cfg.Render.GIFMaxBytes = 8 << 20
+	cfg.RateLimits.User = rateLimit{Burst: 10, Rate: 0.5}
+	cfg.RateLimits.Channel = rateLimit{Burst: 30, Rate: 1}
+	return cfg
+}
+
+// loadConfig reads the file at path over the defaults, a missing path only
+// uses the defaults.
+func loadConfig(path string) (config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// envOverrides maps the environment variables to the settings they
+// replace, they win over the file so containers can change a setting
+// without rebuilding it.
+var envOverrides = []struct {
+	key string
+	set func(c *config, v string)
+}{
+	{"CMD_PREFIX", func(c *config, v string) { c.Prefix = v }},
+	{"ROOM_MATCH", func(c *config, v string) { c.Rooms = v }},
+	{"ADMIN_ROLES", func(c *config, v string) { c.AdminRoles = strings.Split(v, ",") }},
+	{"ENGINE_PATH", func(c *config, v string) { c.Engine.Path = v }},
+	{"THEME", func(c *config, v string) { c.Render.Theme = v }},
+	{"THEMES_DIR", func(c *config, v string) { c.Render.ThemesDir = v }},
+	{"GUILDS_FILE", func(c *config, v string) { c.Storage.Guilds = v }},
+	{"AUDIT_LOG", func(c *config, v string) { c.Storage.Audit = v }},
+	{"GAMES_FILE", func(c *config, v string) { c.Storage.Games = v }},
+	{"PLAYERS_FILE", func(c *config, v string) { c.Storage.Players = v }},
+	{"PREFS_FILE", func(c *config, v string) { c.Storage.Prefs = v }},
+	{"DEAD_LETTERS", func(c *config, v string) { c.Storage.DeadLetters = v }},
+	{"HTTP_ADDR", func(c *config, v string) { c.HTTP.Addr = v }},
+	{"HTTP_SPECTATE", func(c *config, v string) { c.HTTP.Spectate = v == "true" || v == "1" }},
+	{"HTTP_API", func(c *config, v string) { c.HTTP.API = v == "true" || v == "1" }},
+}
+
+// applyEnv overrides the settings with the non empty variables returned by
+// getenv.
+func (c *config) applyEnv(getenv func(string) string) {
+	for _, o := range envOverrides {
+		if v := getenv(o.key); v != "" {
+			o.set(c, v)
+		}
+	}
+}
+
+// token resolves the token from its source, the value first, then the file
+// and the variable.
+func (c *config) token(getenv func(string) string) (string, error) {
+	switch {
+	case c.Token.Value != "":
+		return c.Token.Value, nil
+	case c.Token.File != "":
+		b, err := ioutil.ReadFile(c.Token.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	case c.Token.Env != "":
+		if v := getenv(c.Token.Env); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%s is not set", c.Token.Env)
+	}
+	return "", errors.New("no source, set token.value, token.file or token.env")
+}
+
+// validate checks every setting and returns all the problems found, themes
+// are the names of the loaded themes.
+func (c *config) validate(getenv func(string) string, themes []string) error {
+	problems := []string{}
+	add := func(field string, format string, args ...interface{}) {
+		problems = append(problems, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if _, err := c.token(getenv); err != nil {
+		add("token", "%v", err)
+	}
+	if strings.TrimSpace(c.Prefix) == "" {
+		add("prefix", "must not be empty")
+	}
+	if c.Rooms == "" {
+		add("rooms", `must not be empty, use ".*" to allow every channel`)
+	} else if _, err := regexp.Compile(c.Rooms); err != nil {
+		add("rooms", "%v", err)
+	}
+	for _, r := range c.AdminRoles {
+		if parts := strings.Split(r, ":"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			add("admin_roles", "%q is not guildID:roleID", r)
+		}
+	}
+	if c.Engine.Path == "" {
+		add("engine.path", "must not be empty")
+	} else if _, err := exec.LookPath(c.Engine.Path); err != nil {
+		add("engine.path", "%v", err)
+	}
+	if c.Render.Theme != "" && !contains(themes, c.Render.Theme) {
+		add("render.theme", "unknown theme %q, available: %s", c.Render.Theme, strings.Join(themes, ", "))
+	}
+	if c.Render.GIFMaxBytes < 0 {
+		add("render.gif_max_bytes", "must not be negative")
+	}
+	for _, l := range []struct {
+		field string
+		rateLimit
+	}{
+		{"rate_limits.user", c.RateLimits.User},
+		{"rate_limits.channel", c.RateLimits.Channel},
+	} {
+		switch {
+		case l.Rate < 0 || l.Burst < 0:
+			add(l.field, "must not be negative")
+		case l.Rate > 0 && l.Burst < 1:
+			add(l.field, "burst must be at least 1")
+		}
+	}
+	commands := discordchess.CommandNames()
+	for name, cost := range c.RateLimits.Costs {
+		switch {
+		case !contains(commands, name):
+			add("rate_limits.costs", "unknown command %q", name)
+		case cost < 0:
+			add("rate_limits.costs", "%s must not be negative", name)
+		}
+	}
+	for _, s := range []struct{ field, path string }{
+		{"storage.guilds", c.Storage.Guilds},
+		{"storage.audit", c.Storage.Audit},
+		{"storage.games", c.Storage.Games},
+		{"storage.players", c.Storage.Players},
+		{"storage.prefs", c.Storage.Prefs},
+		{"storage.dead_letters", c.Storage.DeadLetters},
+	} {
+		if s.path == "" {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Dir(s.path)); err != nil || !fi.IsDir() {
+			add(s.field, "directory of %q doesn't exist", s.path)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+}
+
+// rateLimits converts the rate limits to the handler ones.
+func (c *config) rateLimits() discordchess.RateLimits {
+	return discordchess.RateLimits{
+		User:    discordchess.RateLimit(c.RateLimits.User),
+		Channel: discordchess.RateLimit(c.RateLimits.Channel),
+		Costs:   c.RateLimits.Costs,
+	}
+}
+
+// themeNames returns the names of the builtin themes and of themes.
+func themeNames(themes []chessimage.Theme) []string {
+	names := chessimage.ThemeNames()
+	for _, t := range themes {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "discordchess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// env returns a getenv backed by vars.
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+token:
+  env: BOT_TOKEN
+prefix: "?"
+rooms: chess-.*
+admin_roles: ["1:2"]
+engine:
+  path: go
+  options:
+    Threads: "2"
+render:
+  theme: classic
+rate_limits:
+  user: {burst: 5, rate: 0.1}
+  costs: {replay: 10}
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.applyEnv(env(map[string]string{"CMD_PREFIX": "$", "ADMIN_ROLES": "3:4,5:6"}))
+
+	if cfg.Prefix != "$" {
+		t.Errorf("prefix = %q, want the env override", cfg.Prefix)
+	}
+	if cfg.Rooms != "chess-.*" {
+		t.Errorf("rooms = %q, want the file value", cfg.Rooms)
+	}
+	if strings.Join(cfg.AdminRoles, ",") != "3:4,5:6" {
+		t.Errorf("admin roles = %v", cfg.AdminRoles)
+	}
+	if cfg.Engine.Options["Threads"] != "2" {
+		t.Errorf("engine options = %v", cfg.Engine.Options)
+	}
+	if l := cfg.rateLimits(); l.User.Burst != 5 || l.Channel.Burst != 30 || l.Costs["replay"] != 10 {
+		t.Errorf("rate limits = %+v, want the user bucket from the file and the default channel", l)
+	}
+	if cfg.Render.GIFMaxBytes != 8<<20 {
+		t.Errorf("gif max bytes = %d, want the default", cfg.Render.GIFMaxBytes)
+	}
+
+	getenv := env(map[string]string{"BOT_TOKEN": "secret"})
+	if err := cfg.validate(getenv, themeNames(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if tok, _ := cfg.token(getenv); tok != "secret" {
+		t.Errorf("token = %q", tok)
+	}
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	path := writeConfig(t, "room: chess\n")
+	if _, err := loadConfig(path); err == nil {
+		t.Fatal("want an error for the misspelled field")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Prefix = " "
+	cfg.Rooms = "chess-("
+	cfg.AdminRoles = []string{"123"}
+	cfg.Engine.Path = "no-such-engine"
+	cfg.Render.Theme = "nope"
+	cfg.Storage.Games = "/no/such/dir/games.json"
+	cfg.RateLimits.Channel.Rate = -1
+	cfg.RateLimits.Costs = map[string]float64{"replya": 5}
+
+	err := cfg.validate(env(nil), themeNames(nil))
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	// every problem is reported at once
+	for _, field := range []string{
+		"token:",
+		"prefix:",
+		"rooms:",
+		"admin_roles:",
+		"engine.path:",
+		"render.theme:",
+		"storage.games:",
+		"rate_limits.channel:",
+		`rate_limits.costs: unknown command "replya"`,
+	} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("missing %q in:\n%v", field, err)
+		}
+	}
+}
+
+func TestValidateEmptyRooms(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Engine.Path = "go"
+	err := cfg.validate(env(map[string]string{"DISCORD_API_KEY": "x"}), themeNames(nil))
+	if err == nil || !strings.Contains(err.Error(), "rooms:") {
+		t.Fatalf("err = %v, want rooms to be required", err)
+	}
+
+	cfg.Rooms = ".*"
+	if err := cfg.validate(env(map[string]string{"DISCORD_API_KEY": "x"}), themeNames(nil)); err != nil {
+		t.Fatal(err)
+	}
+}
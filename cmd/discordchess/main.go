@@ -1,54 +1,224 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/DiscordGophers/discordchess"
+	"github.com/DiscordGophers/discordchess/chessimage"
 	"github.com/bwmarrin/discordgo"
 	_ "github.com/joho/godotenv/autoload"
 )
 
 func main() {
-	dg, err := discordgo.New("Bot " + os.Getenv("DISCORD_API_KEY"))
+	configPath := flag.String("config", os.Getenv("DISCORDCHESS_CONFIG"), "yaml config file, the environment variables override it")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to create discord session: %v", err)
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.applyEnv(os.Getenv)
+
+	var themes []chessimage.Theme
+	if dir := cfg.Render.ThemesDir; dir != "" {
+		themes, err = chessimage.LoadThemes(dir)
+		if err != nil {
+			log.Fatalf("Failed to load themes: %v", err)
+		}
+	}
+	if err := cfg.validate(os.Getenv, themeNames(themes)); err != nil {
+		log.Fatal(err)
 	}
-	defer dg.Close()
+	token, _ := cfg.token(os.Getenv)
 
-	prefix := os.Getenv("CMD_PREFIX")
-	if prefix == "" {
-		prefix = "!"
+	dg, err := discordgo.New("Bot " + token)
+	if err != nil {
+		log.Fatalf("Failed to create discord session: %v", err)
 	}
-	roomMatch := os.Getenv("ROOM_MATCH")
-	adminRoles := strings.Split(os.Getenv("ADMIN_ROLES"), ",")
 
 	log.Println("Starting:")
-	log.Printf("  prefix: %q", prefix)
-	log.Printf("  rooms: %q", roomMatch)
+	if *configPath != "" {
+		log.Printf("  config: %q", *configPath)
+	}
+	log.Printf("  prefix: %q", cfg.Prefix)
+	log.Printf("  rooms: %q", cfg.Rooms)
+	log.Printf("  engine: %q", cfg.Engine.Path)
+	log.Printf("  rate limits: user %+v, channel %+v", cfg.RateLimits.User, cfg.RateLimits.Channel)
+
+	enginePath, engineOptions := cfg.Engine.Path, cfg.Engine.Options
+	opts := []func(c *discordchess.ChessHandler){
+		discordchess.WithEngine(func(level int) (discordchess.Engine, error) {
+			return discordchess.NewUCIEngine(enginePath, level, engineOptions)
+		}),
+		discordchess.WithGIFMaxBytes(cfg.Render.GIFMaxBytes),
+		discordchess.WithRateLimits(cfg.rateLimits()),
+	}
+	if len(themes) > 0 {
+		log.Printf("  themes: %d from %q", len(themes), cfg.Render.ThemesDir)
+		opts = append(opts, discordchess.WithThemes(themes...))
+	}
+	if cfg.Render.Theme != "" {
+		log.Printf("  theme: %q", cfg.Render.Theme)
+		opts = append(opts, discordchess.WithDefaultTheme(cfg.Render.Theme))
+	}
+
+	if path := cfg.Storage.Guilds; path != "" {
+		store, err := discordchess.LoadConfigStore(path)
+		if err != nil {
+			log.Fatalf("Failed to load guilds config: %v", err)
+		}
+		log.Printf("  guilds: %q", path)
+		opts = append(opts, discordchess.WithConfigStore(store))
+	}
+
+	if path := cfg.Storage.Audit; path != "" {
+		audit, err := discordchess.OpenAuditLog(path)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer audit.Close()
+		log.Printf("  audit: %q", path)
+		opts = append(opts, discordchess.WithAuditLog(audit))
+	}
+
+	if path := cfg.Storage.Players; path != "" {
+		players, err := discordchess.LoadPlayerStore(path)
+		if err != nil {
+			log.Fatalf("Failed to load players: %v", err)
+		}
+		log.Printf("  players: %q", path)
+		opts = append(opts, discordchess.WithPlayerStore(players))
+	}
+
+	if path := cfg.Storage.Prefs; path != "" {
+		prefs, err := discordchess.LoadPrefStore(path)
+		if err != nil {
+			log.Fatalf("Failed to load preferences: %v", err)
+		}
+		log.Printf("  prefs: %q", path)
+		opts = append(opts, discordchess.WithPrefStore(prefs))
+	}
+
+	if path := cfg.Storage.DeadLetters; path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open dead letters: %v", err)
+		}
+		defer f.Close()
+		log.Printf("  dead letters: %q", path)
+		opts = append(opts, discordchess.WithWebhookDeadLetters(f))
+	}
+
+	if path := cfg.Storage.Games; path != "" {
+		log.Printf("  games: %q", path)
+		opts = append(opts, discordchess.WithGamesFile(path))
+	}
 
 	dc, err := discordchess.New(
-		prefix,
-		roomMatch,
-		adminRoles,
+		cfg.Prefix,
+		cfg.Rooms,
+		cfg.AdminRoles,
+		opts...,
 	)
 	if err != nil {
 		log.Fatalf("Failed to create discordchess handler: %v", err)
 	}
+	n, err := dc.LoadGames()
+	if err != nil {
+		log.Fatalf("Failed to restore games: %v", err)
+	}
+	log.Printf("  restored %d games", n)
 
 	dg.AddHandler(dc.MessageCreateHandler)
 
-	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions
+	// guilds keeps the roles and channels in the state for the permissions
+	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions
 
 	if err := dg.Open(); err != nil {
 		log.Fatalf("Failed to open discord connection: %v", err)
 	}
 
+	if addr := cfg.HTTP.Addr; addr != "" {
+		log.Printf("  http: %q", addr)
+		go func() {
+			if err := http.ListenAndServe(addr, httpHandler(dg, dc, cfg)); err != nil {
+				log.Fatalf("Failed to serve http: %v", err)
+			}
+		}()
+	}
+
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 
 	<-sc
+	log.Println("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := dc.Shutdown(ctx, discordchess.DiscordSession(dg)); err != nil {
+		log.Printf("Failed to shutdown cleanly: %v", err)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- dg.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			log.Printf("Failed to close discord connection: %v", err)
+		}
+	case <-ctx.Done():
+		log.Println("Timed out closing discord connection")
+	}
+}
+
+// shutdownTimeout bounds the time to finish the running commands and close
+// the connection.
+const shutdownTimeout = 10 * time.Second
+
+// httpHandler serves the health check, the metrics and the spectator pages
+// and the api if enabled.
+func httpHandler(dg *discordgo.Session, dc *discordchess.ChessHandler, cfg config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		problems := []string{}
+		dg.RLock()
+		ready := dg.DataReady
+		dg.RUnlock()
+		if !ready {
+			problems = append(problems, "discord gateway disconnected")
+		}
+		if _, err := exec.LookPath(cfg.Engine.Path); err != nil {
+			problems = append(problems, "engine unavailable")
+		}
+		if len(problems) > 0 {
+			http.Error(w, strings.Join(problems, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		dc.WriteMetrics(w)
+	})
+	if cfg.HTTP.Spectate {
+		web := dc.WebHandler()
+		mux.Handle("/watch/", web)
+		mux.Handle("/overlay/", web)
+	}
+	if cfg.HTTP.API {
+		api := dc.APIHandler()
+		mux.Handle("/games", api)
+		mux.Handle("/games/", api)
+		mux.Handle("/players/", api)
+	}
+	return mux
 }
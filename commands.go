@@ -0,0 +1,387 @@
+package discordchess
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/notnil/chess"
+)
+
+// builtinCommands returns the commands in the order they are listed in the
+// help.
+func builtinCommands() []*command {
+	return []*command{
+		{
+			name: "help",
+			args: []arg{{name: "command", optional: true}},
+			help: "show this, or the help of a command",
+			run:  (*ChessHandler).cmdHelp,
+		},
+		{
+			name:    "play",
+			args:    []arg{{name: "player1", mention: true}, {name: "player2", mention: true}},
+			room:    true,
+			help:    "starts a game",
+			details: "Mention the bot to play against the engine.",
+			run:     (*ChessHandler).cmdPlay,
+		},
+		{
+			name:    "move",
+			aliases: []string{"m"},
+			args:    []arg{{name: "move", optional: true}},
+			perm:    permTurn,
+			help:    "do a move in algebraic notation",
+			details: "Without a move it lists the valid moves.",
+			run:     (*ChessHandler).cmdMove,
+		},
+		{
+			// the square and svg come in any order, cmdBoard tells them apart
+			name:    "board",
+			aliases: []string{"b"},
+			args:    []arg{{name: "square", optional: true}, {name: "svg", optional: true}},
+			game:    true,
+			help:    "shows the board, optionally with the legal moves of a piece or as svg",
+			cost:    2,
+			run:     (*ChessHandler).cmdBoard,
+		},
+		{
+			name:    "arrow",
+			args:    []arg{{name: "annotation", variadic: true}},
+			game:    true,
+			help:    "draws arrows or circles on the board i.e: `e2e4 g1f3 d5`",
+			details: "Arrows are written as the origin and destination squares and circles as a square.",
+			cost:    2,
+			run:     (*ChessHandler).cmdArrow,
+		},
+		{
+			name:    "replay",
+			aliases: []string{"cool"},
+			args:    []arg{{choices: []string{"gif", "apng"}, optional: true}},
+			game:    true,
+			help:    "shows an animated replay of the game",
+			cost:    5,
+			run:     (*ChessHandler).cmdReplay,
+		},
+		{
+			name: "evalbar",
+			args: []arg{{choices: []string{"on", "off"}}},
+			perm: permPlayer,
+			help: "shows the engine evaluation in games against the bot",
+			run:  (*ChessHandler).cmdEvalBar,
+		},
+		{
+			name: "theme",
+			args: []arg{{name: "name", optional: true}},
+			help: "sets your board theme, boards use the theme of the player to move",
+			run:  (*ChessHandler).cmdTheme,
+		},
+		{
+			name: "resign",
+			perm: permTurn,
+			help: "resigns the game",
+			run:  (*ChessHandler).cmdResign,
+		},
+		{
+			name:    "draw",
+			perm:    permPlayer,
+			help:    "offer draw",
+			details: "The game is drawn when both players send it, a move clears the offers.",
+			run:     (*ChessHandler).cmdDraw,
+		},
+		{
+			name:    "abort",
+			aliases: []string{"cancel"},
+			perm:    permModerator,
+			game:    true,
+			help:    "ends the game without a result",
+			run:     (*ChessHandler).cmdAbort,
+		},
+		{
+			name: "adjudicate",
+			args: []arg{{choices: []string{"white", "black", "draw"}}},
+			perm: permModerator,
+			game: true,
+			help: "ends the game with the given result",
+			run:  (*ChessHandler).cmdAdjudicate,
+		},
+		{
+			name:    "kick-game",
+			perm:    permModerator,
+			game:    true,
+			help:    "removes a stuck game from the channel",
+			details: "The game is dropped without the game over card nor the replay.",
+			run:     (*ChessHandler).cmdKickGame,
+		},
+		{
+			name: "config",
+			args: []arg{
+				{choices: []string{"set", "admin-role", "webhook"}, optional: true},
+				{name: "key", optional: true},
+				{name: "value", optional: true},
+			},
+			perm: permAdmin,
+			help: "shows or changes the server settings",
+			details: "" +
+				"`config set prefix <prefix>` - the command prefix\n" +
+				"`config set rooms <regexp>` - the channels where games can be played\n" +
+				"`config set level <0-20>` - the bot strength\n" +
+				"`config set time <minutes>+<increment>|none` - the time control of new games\n" +
+				"`config admin-role add|remove @role` - the roles allowed to run admin commands\n" +
+				"`config webhook add|remove <url>` - the urls receiving the game events, `config webhook list` shows them",
+			run: (*ChessHandler).cmdConfig,
+		},
+		{
+			name:    "audit",
+			args:    []arg{{name: "game", optional: true}},
+			perm:    permAdmin,
+			help:    "shows the recorded events of a game",
+			details: "The game ID is shown in the game over card, without one the game in the channel is used.",
+			run:     (*ChessHandler).cmdAudit,
+		},
+		{
+			name:   "say",
+			hidden: true,
+			cost:   2,
+			run:    (*ChessHandler).cmdSay,
+		},
+	}
+}
+
+// CommandNames returns the names of the builtin commands, the keys of
+// RateLimits.Costs.
+func CommandNames() []string {
+	names := []string{}
+	for _, cmd := range builtinCommands() {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+func (c *ChessHandler) cmdHelp(r *request) error {
+	msg := c.help(r.cfg.prefix)
+	if len(r.args) > 0 {
+		name := strings.TrimPrefix(r.args[0], r.cfg.prefix)
+		cmd := c.commands.lookup(name)
+		if cmd == nil || cmd.hidden {
+			return GameError(fmt.Sprintf("Unknown command %q", name))
+		}
+		msg = commandHelp(r.cfg.prefix, cmd)
+	}
+	_, err := r.s.ChannelMessageSend(r.m.ChannelID, msg)
+	return err
+}
+
+func (c *ChessHandler) cmdPlay(r *request) error {
+	s, m := r.s, r.m
+	if g := c.states.game(m.ChannelID); g != nil {
+		return GameError(fmt.Sprintf("Game in Process <@%s> vs <@%s>", g.whiteID, g.blackID))
+	}
+
+	// check for mentions
+	if len(m.Mentions) != 2 {
+		return GameError(fmt.Sprintf("Start a game with `%splay @player1 @player2`", r.cfg.prefix))
+	}
+
+	if err := r.react(); err != nil {
+		return err
+	}
+
+	// if one of the mentions is the bot we initialize an engine in this game
+	var eng Engine
+	if m.Mentions[0].ID == s.BotID() || m.Mentions[1].ID == s.BotID() {
+		if _, err := s.ChannelMessageSend(m.ChannelID, "Trying to play with AI"); err != nil {
+			return err
+		}
+		var err error
+		eng, err = c.newEngine(r.cfg.botLevel)
+		if err != nil {
+			return GameError(fmt.Sprint("Error starting game: ", err))
+		}
+	}
+
+	g := c.states.newGame(
+		m.GuildID,
+		m.ChannelID,
+		m.Mentions[0].ID,
+		m.Mentions[1].ID,
+		eng,
+		r.cfg.timeControl,
+	)
+	defer g.unlock()
+	g.botLevel = r.cfg.botLevel
+	c.metrics.gamesStarted.inc()
+	c.audit(g, m.Author.ID, auditCreated, fmt.Sprintf("white %s, black %s, time control %s", g.whiteID, g.blackID, r.cfg.timeControl))
+	return c.checkOutcome(g, s, m.ChannelID)
+}
+
+func (c *ChessHandler) cmdMove(r *request) error {
+	g := r.g
+	if len(r.args) == 0 {
+		return r.reply(fmt.Sprint("Valid moves:", validMovesStr(g)))
+	}
+
+	if err := g.MoveStr(r.args[0]); err != nil {
+		return GameError(fmt.Sprint("Invalid move\nAvailable: ", validMovesStr(g)))
+	}
+	moves := movesNotation(g)
+	c.audit(g, r.m.Author.ID, auditMove, moves[len(moves)-1])
+
+	if err := r.react(); err != nil {
+		return err
+	}
+	return c.checkOutcome(g, r.s, r.m.ChannelID)
+}
+
+func (c *ChessHandler) cmdBoard(r *request) error {
+	g := r.g
+	if len(r.args) == 0 {
+		return c.checkOutcome(g, r.s, r.m.ChannelID)
+	}
+
+	svg := false
+	var hints []chessimage.Mark
+	square := ""
+	for _, a := range r.args {
+		switch {
+		case strings.EqualFold(a, "svg") && !svg:
+			svg = true
+		case square != "":
+			return GameError(fmt.Sprintf("Usage: `%s`, one square at a time", usage(r.cfg.prefix, r.cmd)))
+		default:
+			square = a
+		}
+	}
+	if square != "" {
+		sq, ok := chessimage.ParseSquare(square)
+		if !ok {
+			return GameError(fmt.Sprintf("Invalid square %q", square))
+		}
+		if hints = moveHints(g, sq); len(hints) == 0 {
+			return GameError(fmt.Sprintf("No legal moves from %s", sq))
+		}
+	}
+	if svg {
+		return c.sendBoardSVG(g, r.s, r.m.ChannelID, hints...)
+	}
+	return c.sendBoard(g, r.s, r.m.ChannelID, hints...)
+}
+
+func (c *ChessHandler) cmdArrow(r *request) error {
+	marks, err := annotationMarks(r.args)
+	if err != nil {
+		return err
+	}
+	return c.sendBoard(r.g, r.s, r.m.ChannelID, marks...)
+}
+
+func (c *ChessHandler) cmdReplay(r *request) error {
+	if len(r.args) > 0 && strings.ToLower(r.args[0]) == "apng" {
+		return c.sendAPNG(r.g, r.s, r.m.ChannelID, r.m.Author.ID)
+	}
+	return c.coolThing(r.g, r.s, r.m.ChannelID)
+}
+
+func (c *ChessHandler) cmdEvalBar(r *request) error {
+	// Human games never get an engine, so the bar can't be used to
+	// cheat
+	if r.g.eng == nil {
+		return GameError("The eval bar is only available in games against the bot")
+	}
+	r.g.evalBar = strings.ToLower(r.args[0]) == "on"
+	return r.react()
+}
+
+func (c *ChessHandler) cmdTheme(r *request) error {
+	if len(r.args) == 0 {
+		current := c.prefs.theme(r.m.Author.ID)
+		if current == "" {
+			current = c.defaultTheme
+		}
+		if current == "" {
+			current = "classic"
+		}
+		_, err := r.s.ChannelMessageSend(
+			r.m.ChannelID,
+			fmt.Sprintf("Your theme: `%s`\nAvailable: `%s`", current, strings.Join(c.themeNames, "`, `")),
+		)
+		return err
+	}
+
+	name := strings.ToLower(r.args[0])
+	if _, ok := c.themes[name]; !ok {
+		return GameError(fmt.Sprintf("Unknown theme %q, available: `%s`", name, strings.Join(c.themeNames, "`, `")))
+	}
+	if err := c.prefs.setTheme(r.m.Author.ID, name); err != nil {
+		return err
+	}
+	return r.react()
+}
+
+func (c *ChessHandler) cmdResign(r *request) error {
+	r.g.Resign(r.g.Position().Turn())
+	c.audit(r.g, r.m.Author.ID, auditResign, "")
+	return c.checkOutcome(r.g, r.s, r.m.ChannelID)
+}
+
+// Useless for now but might be usefull if we have some kind of ranking
+func (c *ChessHandler) cmdDraw(r *request) error {
+	g := r.g
+	if err := r.react(); err != nil {
+		return err
+	}
+
+	if g.draw(r.m.Author.ID) {
+		g.Draw(chess.DrawOffer)
+		c.audit(g, r.m.Author.ID, auditDrawAccepted, "")
+		return c.checkOutcome(g, r.s, r.m.ChannelID)
+	}
+	c.audit(g, r.m.Author.ID, auditDrawOffered, "")
+
+	other := g.whiteID
+	if other == r.m.Author.ID {
+		other = g.blackID
+	}
+	_, err := r.s.ChannelMessageSend(
+		r.m.ChannelID,
+		fmt.Sprintf("<@%s> send `%sdraw` to accept", other, r.cfg.prefix),
+	)
+	return err
+}
+
+func (c *ChessHandler) cmdAbort(r *request) error {
+	r.g.abort(r.m.Author.ID)
+	c.audit(r.g, r.m.Author.ID, auditAbort, "")
+	return c.GameOver(r.g, r.s, r.m.ChannelID)
+}
+
+func (c *ChessHandler) cmdAdjudicate(r *request) error {
+	outcome := map[string]chess.Outcome{
+		"white": chess.WhiteWon,
+		"black": chess.BlackWon,
+		"draw":  chess.Draw,
+	}[strings.ToLower(r.args[0])]
+	r.g.adjudicate(outcome, r.m.Author.ID)
+	c.audit(r.g, r.m.Author.ID, auditAdjudicate, outcome.String())
+	return c.checkOutcome(r.g, r.s, r.m.ChannelID)
+}
+
+func (c *ChessHandler) cmdKickGame(r *request) error {
+	c.states.done(r.m.ChannelID)
+	c.live.drop(r.g.id)
+	c.audit(r.g, r.m.Author.ID, auditKick, "")
+	_, err := r.s.ChannelMessageSend(
+		r.m.ChannelID,
+		fmt.Sprintf("Game <@%s> vs <@%s> removed by <@%s>", r.g.whiteID, r.g.blackID, r.m.Author.ID),
+	)
+	return err
+}
+
+func (c *ChessHandler) cmdSay(r *request) error {
+	msg := r.rest
+	if msg == "" {
+		return nil
+	}
+	_, err := r.s.ChannelMessageSend(r.m.ChannelID, msg)
+	return err
+}
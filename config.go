@@ -0,0 +1,275 @@
+package discordchess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// guildConfig holds the settings of a guild, empty fields use the handler
+// defaults.
+type guildConfig struct {
+	Prefix      string    `json:"prefix,omitempty"`
+	Rooms       string    `json:"rooms,omitempty"`
+	AdminRoles  []string  `json:"admin_roles,omitempty"`
+	BotLevel    *int      `json:"bot_level,omitempty"`
+	TimeControl string    `json:"time_control,omitempty"`
+	Webhooks    []webhook `json:"webhooks,omitempty"`
+}
+
+// ConfigStore keeps the guilds configuration, in memory or in a json file.
+type ConfigStore struct {
+	path   string
+	guilds map[string]*guildConfig
+	// rooms caches the compiled rooms regexps
+	rooms map[string]*regexp.Regexp
+	mu    sync.Mutex
+}
+
+// NewConfigStore returns a store kept in memory.
+func NewConfigStore() *ConfigStore {
+	return &ConfigStore{
+		guilds: map[string]*guildConfig{},
+		rooms:  map[string]*regexp.Regexp{},
+	}
+}
+
+// LoadConfigStore loads the store from the json file at path, the file is
+// created on the first change if it doesn't exist.
+func LoadConfigStore(path string) (*ConfigStore, error) {
+	cs := NewConfigStore()
+	cs.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cs.guilds); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for id, g := range cs.guilds {
+		if g.Rooms == "" {
+			continue
+		}
+		re, err := regexp.Compile(g.Rooms)
+		if err != nil {
+			return nil, fmt.Errorf("%s: guild %s rooms: %w", path, id, err)
+		}
+		cs.rooms[id] = re
+	}
+	return cs, nil
+}
+
+// get returns a copy of the guild config.
+func (cs *ConfigStore) get(guildID string) (guildConfig, *regexp.Regexp) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	g, ok := cs.guilds[guildID]
+	if !ok {
+		return guildConfig{}, nil
+	}
+	cfg := *g
+	cfg.AdminRoles = append([]string(nil), g.AdminRoles...)
+	cfg.Webhooks = append([]webhook(nil), g.Webhooks...)
+	return cfg, cs.rooms[guildID]
+}
+
+// update applies fn to the guild config and saves the store.
+func (cs *ConfigStore) update(guildID string, fn func(g *guildConfig) error) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	g, ok := cs.guilds[guildID]
+	if !ok {
+		g = &guildConfig{}
+	}
+	cfg := *g
+	cfg.AdminRoles = append([]string(nil), g.AdminRoles...)
+	cfg.Webhooks = append([]webhook(nil), g.Webhooks...)
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+
+	var re *regexp.Regexp
+	if cfg.Rooms != "" {
+		var err error
+		if re, err = regexp.Compile(cfg.Rooms); err != nil {
+			return GameError(fmt.Sprintf("Invalid rooms regexp: %v", err))
+		}
+	}
+	cs.guilds[guildID] = &cfg
+	cs.rooms[guildID] = re
+	return cs.save()
+}
+
+// save writes the store to its file if any, replacing it atomically.
+func (cs *ConfigStore) save() error {
+	if cs.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(cs.guilds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cs.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// settings are the resolved settings of a guild.
+type settings struct {
+	prefix string
+	rooms  *regexp.Regexp
+	// adminRoles are the role IDs of the guild admins
+	adminRoles  []string
+	botLevel    int
+	timeControl timeControl
+}
+
+// maxBotLevel is the strongest engine level, the default.
+const maxBotLevel = 20
+
+// settings resolves the guild config over the handler defaults.
+func (c *ChessHandler) settings(guildID string) settings {
+	cfg, rooms := c.config.get(guildID)
+	st := settings{
+		prefix:     c.prefix,
+		rooms:      c.channelRE,
+		adminRoles: cfg.AdminRoles,
+		botLevel:   maxBotLevel,
+	}
+	// the global roles are written as guildID:roleID
+	for r := range c.adminRoles {
+		if i := strings.IndexByte(r, ':'); i >= 0 && r[:i] == guildID {
+			st.adminRoles = append(st.adminRoles, r[i+1:])
+		}
+	}
+	if cfg.Prefix != "" {
+		st.prefix = cfg.Prefix
+	}
+	if rooms != nil {
+		st.rooms = rooms
+	}
+	if cfg.BotLevel != nil {
+		st.botLevel = *cfg.BotLevel
+	}
+	// stored time controls are validated on set
+	st.timeControl, _ = parseTimeControl(cfg.TimeControl)
+	return st
+}
+
+func (c *ChessHandler) cmdConfig(r *request) error {
+	if len(r.args) == 0 {
+		_, err := r.s.ChannelMessageSend(r.m.ChannelID, describeSettings(r.cfg))
+		return err
+	}
+
+	var err error
+	switch strings.ToLower(r.args[0]) {
+	case "set":
+		if len(r.args) != 3 {
+			return GameError(fmt.Sprintf("Usage: `%sconfig set prefix|rooms|level|time <value>`", r.cfg.prefix))
+		}
+		err = c.config.update(r.m.GuildID, func(g *guildConfig) error {
+			return setConfig(g, strings.ToLower(r.args[1]), r.args[2])
+		})
+	case "webhook":
+		return c.configWebhook(r)
+	case "admin-role":
+		if len(r.args) != 3 || len(r.m.MentionRoles) != 1 {
+			return GameError(fmt.Sprintf("Usage: `%sconfig admin-role add|remove @role`", r.cfg.prefix))
+		}
+		role := r.m.MentionRoles[0]
+		err = c.config.update(r.m.GuildID, func(g *guildConfig) error {
+			switch strings.ToLower(r.args[1]) {
+			case "add":
+				if !contains(g.AdminRoles, role) {
+					g.AdminRoles = append(g.AdminRoles, role)
+				}
+			case "remove":
+				roles := g.AdminRoles[:0]
+				for _, ar := range g.AdminRoles {
+					if ar != role {
+						roles = append(roles, ar)
+					}
+				}
+				g.AdminRoles = roles
+			default:
+				return GameError("Use `add` or `remove`")
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return r.react()
+}
+
+// setConfig validates and sets a config key.
+func setConfig(g *guildConfig, key, value string) error {
+	switch key {
+	case "prefix":
+		g.Prefix = value
+	case "rooms":
+		g.Rooms = value
+	case "level":
+		lvl, err := strconv.Atoi(value)
+		if err != nil || lvl < 0 || lvl > maxBotLevel {
+			return GameError(fmt.Sprintf("The bot level must be between 0 and %d", maxBotLevel))
+		}
+		g.BotLevel = &lvl
+	case "time":
+		tc, err := parseTimeControl(value)
+		if err != nil {
+			return err
+		}
+		g.TimeControl = tc.String()
+	default:
+		return GameError(fmt.Sprintf("Unknown setting %q, use `prefix`, `rooms`, `level` or `time`", key))
+	}
+	return nil
+}
+
+func describeSettings(st settings) string {
+	roles := []string{}
+	for _, r := range st.adminRoles {
+		roles = append(roles, fmt.Sprintf("<@&%s>", r))
+	}
+	sort.Strings(roles)
+	if len(roles) == 0 {
+		roles = append(roles, "none")
+	}
+	return fmt.Sprintf(
+		"Prefix: `%s`\nRooms: `%s`\nAdmin roles: %s\nBot level: %d\nTime control: %s",
+		st.prefix, st.rooms, strings.Join(roles, ", "), st.botLevel, st.timeControl,
+	)
+}
@@ -5,18 +5,17 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/gif"
 	"image/png"
 	"io"
 	"log"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/DiscordGophers/discordchess/chessimage"
 	"github.com/bwmarrin/discordgo"
 	"github.com/notnil/chess"
-	"github.com/notnil/chess/uci"
 )
 
 type GameError string
@@ -25,32 +24,68 @@ func (e GameError) Error() string { return string(e) }
 
 var ErrNoGame = GameError("No game in progress")
 
-var help = "" +
-	"Help:\n" +
-	"  `%[1]shelp` - show this\n" +
-	"  `%[1]splay @player1 @player2` - starts a game\n" +
-	"  `%[1]smove <move>` - do a move in algebraic notation\n" +
-	"  `%[1]sboard` - shows the board\n" +
-	"  `%[1]sresign` - resigns the game\n" +
-	"  `%[1]sdraw` - offer draw\n"
+// moveListRows is the number of full moves shown next to the board.
+const moveListRows = 14
 
 type ChessHandler struct {
 	prefix     string
 	channelRE  *regexp.Regexp
 	adminRoles map[string]struct{}
-	drawer     *chessimage.Drawer
+	drawer     *sharedDrawer
 	states     *state
+	prefs      *PrefStore
+	commands   *router
+
+	themeNames []string
+	themes     map[string]chessimage.Theme
+	drawers    map[string]*sharedDrawer
+	webDrawers map[string]*sharedDrawer
+	// webDrawerKeys are the keys of webDrawers, least recently used first
+	webDrawerKeys []string
+	drawersMu     sync.Mutex
+	// defaultTheme is used for the users that didn't pick one
+	defaultTheme string
+
+	// gifMaxBytes is the size budget for replays
+	gifMaxBytes int
+
+	// newEngine starts the engine for games against the bot
+	newEngine func(level int) (Engine, error)
+	config    *ConfigStore
+
+	// textBoard sends the boards as text instead of images
+	textBoard bool
+
+	log      *logger
+	auditLog *AuditLog
+	metrics  *metrics
+	// limiter is nil without rate limits
+	limiter *limiter
+	// live keeps the views of the games for the web pages
+	live     *live
+	players  *PlayerStore
+	webhooks *webhooks
+
+	// gamesFile keeps the games in progress across restarts
+	gamesFile string
+	// closing stops accepting commands, inflight are the running ones
+	closing   bool
+	closingMu sync.RWMutex
+	inflight  sync.WaitGroup
 }
 
-func New(cmdPrefix, channelRe string, adminRoles []string) (*ChessHandler, error) {
-	re := regexp.MustCompile(channelRe)
+func New(cmdPrefix, channelRe string, adminRoles []string, opts ...func(c *ChessHandler)) (*ChessHandler, error) {
+	re, err := regexp.Compile(channelRe)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rooms regexp: %w", err)
+	}
 
 	roleMap := map[string]struct{}{}
 	for _, r := range adminRoles {
 		roleMap[r] = struct{}{}
 	}
 
-	drawer, err := chessimage.NewDrawer()
+	drawer, err := chessimage.NewDrawer(chessimage.WithMoveList(moveListRows))
 	if err != nil {
 		return nil, err
 	}
@@ -59,274 +94,250 @@ func New(cmdPrefix, channelRe string, adminRoles []string) (*ChessHandler, error
 		prefix:     cmdPrefix,
 		channelRE:  re,
 		adminRoles: roleMap,
-		drawer:     drawer,
+		drawer:     &sharedDrawer{Drawer: drawer},
 		states: &state{
 			games: make(map[string]*game),
 		},
+		prefs:       NewPrefStore(),
+		commands:    newRouter(builtinCommands()...),
+		themes:      make(map[string]chessimage.Theme),
+		drawers:     make(map[string]*sharedDrawer),
+		webDrawers:  make(map[string]*sharedDrawer),
+		gifMaxBytes: 8 << 20, // discord upload limit
+		newEngine: func(level int) (Engine, error) {
+			return NewUCIEngine("stockfish", level, nil)
+		},
+		config:   NewConfigStore(),
+		log:      &logger{out: log.Default()},
+		auditLog: NewAuditLog(),
+		metrics:  newMetrics(),
+		live:     newLive(),
+		players:  NewPlayerStore(),
+	}
+	c.webhooks = newWebhooks(c.log, c.metrics)
+	for _, name := range chessimage.ThemeNames() {
+		t, _ := chessimage.ThemeByName(name)
+		c.addTheme(t)
+	}
+	for _, fn := range opts {
+		fn(c)
 	}
 	return c, nil
 }
 
-func (c *ChessHandler) MessageCreateHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
-	err := c.messageCreateHandler(s, m)
-	if e, ok := err.(GameError); ok {
-		s.MessageReactionAdd(m.ChannelID, m.ID, `❌`)
-		if e != "" {
-			s.ChannelMessageSendReply(
-				m.ChannelID,
-				string(e),
-				&discordgo.MessageReference{
-					ChannelID: m.ChannelID,
-					MessageID: m.ID,
-				})
+// WithThemes adds themes to the ones available with the theme command.
+func WithThemes(themes ...chessimage.Theme) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		for _, t := range themes {
+			c.addTheme(t)
 		}
-		return
-	}
-	if err != nil {
-		log.Println("unhandled error:", err)
 	}
 }
 
-func (c *ChessHandler) messageCreateHandler(s *discordgo.Session, m *discordgo.MessageCreate) error {
-	if !strings.HasPrefix(m.Content, c.prefix) {
-		return nil
+// WithDefaultTheme sets the theme of the users that didn't pick one, it must
+// be a builtin theme or one added with WithThemes.
+func WithDefaultTheme(name string) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.defaultTheme = name
 	}
+}
 
-	cmd := strings.Fields(
-		strings.Replace(m.Content, c.prefix, "", 1),
-	)
-
-	if len(cmd) == 0 {
-		return nil
+// WithGIFMaxBytes sets the size budget for replay gifs, zero disables it.
+func WithGIFMaxBytes(n int) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.gifMaxBytes = n
 	}
+}
 
-	switch cmd[0] {
-	case "cool":
-		g := c.states.game(m.ChannelID)
-		if g == nil {
-			return ErrNoGame
-		}
-		return c.coolThing(g, s, m.ChannelID)
-	case "cancel":
-		g := c.states.game(m.ChannelID)
-		if g == nil {
-			return ErrNoGame
-		}
-		allow := false
-		// TODO: {lpf} I'm not sure if we need to include guildIDs or
-		// just role to avoid other guild admins to cancel the game in
-		// 'this' guild
-		for _, mr := range m.Member.Roles {
-			r := fmt.Sprintf("%s:%s", m.GuildID, mr)
-			if _, ok := c.adminRoles[r]; ok {
-				allow = true
-				break
-			}
-		}
-		if !allow {
-			return GameError("")
-		}
-		if err := g.Draw(chess.DrawOffer); err != nil {
-			return err
-		}
-		return c.checkOutcome(g, s, m.ChannelID)
-	case "say":
-		msg := strings.Replace(m.Content, c.prefix+"say", "", 1)
-		if msg == "" {
-			return nil
-		}
-		_, err := s.ChannelMessageSend(
-			m.ChannelID,
-			msg,
-		)
-		return err
-	case "help":
-		_, err := s.ChannelMessageSend(
-			m.ChannelID,
-			fmt.Sprintf(help, c.prefix),
-		)
-		return err
-	case "play":
-		if g := c.states.game(m.ChannelID); g != nil {
-			return GameError(fmt.Sprintf("Game in Process <@%s> vs <@%s>", g.whiteID, g.blackID))
-		}
-
-		// check for mentions
-		if len(cmd) != 3 || len(m.Mentions) != 2 {
-			return GameError(fmt.Sprintf("Start a game with `%splay @player1 @player2`", c.prefix))
-		}
+// WithEngine sets the function starting the engine for games against the
+// bot with the guild skill level, stockfish is used by default.
+func WithEngine(fn func(level int) (Engine, error)) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.newEngine = fn
+	}
+}
 
-		// verify channel name
-		channel, err := s.Channel(m.ChannelID)
-		if err != nil {
-			return err
-		}
-		if !c.channelRE.MatchString(channel.Name) {
-			return GameError("wrong room")
-		}
+// WithTextBoard sends the boards as text instead of images.
+func WithTextBoard(text bool) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.textBoard = text
+	}
+}
 
-		if err := s.MessageReactionAdd(m.ChannelID, m.ID, "✅"); err != nil {
-			return err
-		}
+// WithConfigStore sets the store of the guilds configuration, it is kept in
+// memory by default.
+func WithConfigStore(cs *ConfigStore) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.config = cs
+	}
+}
 
-		// if one of the mentions is the bot we initialize internal stockfish in this game
-		initUCI := false
-		if m.Mentions[0].ID == s.State.User.ID || m.Mentions[1].ID == s.State.User.ID {
-			if _, err := s.ChannelMessageSend(m.ChannelID, "Trying to play with AI"); err != nil {
-				return err
-			}
-			initUCI = true
-		}
+// WithLogger sets the logger of the structured logs, the standard logger is
+// used by default.
+func WithLogger(l *log.Logger) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.log = &logger{out: l}
+	}
+}
 
-		g, err := c.states.newGame(
-			m.ChannelID,
-			m.Mentions[0].ID,
-			m.Mentions[1].ID,
-			initUCI,
-		)
-		if err != nil {
-			return GameError(fmt.Sprint("Error starting game: ", err))
-		}
+// WithAuditLog sets the log recording the game events, it is kept in memory
+// by default.
+func WithAuditLog(a *AuditLog) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.auditLog = a
+	}
+}
 
-		return c.checkOutcome(g, s, m.ChannelID)
+func (c *ChessHandler) addTheme(t chessimage.Theme) {
+	if _, ok := c.themes[t.Name]; !ok {
+		c.themeNames = append(c.themeNames, t.Name)
+	}
+	c.themes[t.Name] = t
+}
 
-	case "move":
-		g := c.states.game(m.ChannelID)
-		if g == nil {
-			return ErrNoGame
-		}
+// MessageCreateHandler handles the discord message events.
+func (c *ChessHandler) MessageCreateHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	c.HandleMessage(DiscordSession(s), m)
+}
 
-		if m.Author.ID != g.turn() {
-			return GameError("")
-		}
+// HandleMessage runs the command in m, errors are reported with a reaction
+// and a reply to the message and logged by the router.
+func (c *ChessHandler) HandleMessage(s Session, m *discordgo.MessageCreate) {
+	if !c.begin() {
+		return
+	}
+	defer c.inflight.Done()
 
-		if len(cmd) < 2 {
-			_, err := s.ChannelMessageSendReply(
+	err := c.messageCreateHandler(s, m)
+	if e, ok := err.(GameError); ok {
+		s.MessageReactionAdd(m.ChannelID, m.ID, `❌`)
+		if e != "" {
+			s.ChannelMessageSendReply(
 				m.ChannelID,
-				fmt.Sprint("Valid moves:", validMovesStr(g)),
+				string(e),
 				&discordgo.MessageReference{
 					ChannelID: m.ChannelID,
 					MessageID: m.ID,
-				},
-			)
-			return err
-		}
-
-		if err := g.MoveStr(cmd[1]); err != nil {
-			return GameError(fmt.Sprint("Invalid move\nAvailable: ", validMovesStr(g)))
-		}
-
-		if err := s.MessageReactionAdd(m.ChannelID, m.ID, "✅"); err != nil {
-			return err
-		}
-
-		return c.checkOutcome(g, s, m.ChannelID)
-
-	case "board":
-		g := c.states.game(m.ChannelID)
-		if g == nil {
-			return ErrNoGame
-		}
-
-		return c.checkOutcome(g, s, m.ChannelID)
-	// Useless for now but might be usefull if we have some kind of ranking
-	case "draw":
-		g := c.states.game(m.ChannelID)
-		if g == nil {
-			return ErrNoGame
-		}
-
-		if m.Author.ID != g.whiteID && m.Author.ID != g.blackID {
-			return GameError("")
-		}
-		if err := s.MessageReactionAdd(m.ChannelID, m.ID, "✅"); err != nil {
-			return err
-		}
-
-		if g.draw(m.Author.ID) {
-			g.Draw(chess.DrawOffer)
-			return c.checkOutcome(g, s, m.ChannelID)
-		}
-
-		other := g.whiteID
-		if other == m.Author.ID {
-			other = g.blackID
-		}
-		_, err := s.ChannelMessageSend(
-			m.ChannelID,
-			fmt.Sprintf("<@%s> send `%sdraw` to accept", other, c.prefix),
-		)
-		return err
-
-	case "resign":
-		g := c.states.game(m.ChannelID)
-		if g == nil {
-			return ErrNoGame
-		}
-
-		if m.Author.ID != g.turn() {
-			return GameError("")
+				})
 		}
+	}
+}
 
-		g.Resign(g.Position().Turn())
-
-		return c.checkOutcome(g, s, m.ChannelID)
+func (c *ChessHandler) messageCreateHandler(s Session, m *discordgo.MessageCreate) error {
+	cfg := c.settings(m.GuildID)
+	if !strings.HasPrefix(m.Content, cfg.prefix) {
+		return nil
 	}
-	return nil
+
+	return c.dispatch(s, m, cfg, strings.Replace(m.Content, cfg.prefix, "", 1))
 }
 
 // checkOutcome will send the board, check for outcome and send the game status
 // if game is over it will delete from game states
 // if the turn() id is same as bot it will use uci to make a move and recheck
 // outcome.
-func (c *ChessHandler) checkOutcome(g *game, s *discordgo.Session, channelID string) error {
+func (c *ChessHandler) checkOutcome(g *game, s Session, channelID string) error {
+	prev := c.live.get(g.id)
+	c.publish(g, s)
+	c.notifyProgress(g, prev)
 	if err := c.sendBoard(g, s, channelID); err != nil {
-		log.Println("failed to rasterize the board:", err)
+		c.log.error("failed to rasterize the board", err, "game", g.id)
 		// Send the board in text mode if sendBoard fails
-		_, err := s.ChannelMessageSend(
-			channelID,
-			fmt.Sprintf("```\n%s\n```\n", g.Position().Board().Draw()),
-		)
-		if err != nil {
+		if err := c.sendTextBoard(g, s, channelID); err != nil {
 			return err
 		}
 	}
 
-	if o := g.Outcome(); o != chess.NoOutcome {
+	if g.over() {
 		return c.GameOver(g, s, channelID)
 	}
-	if _, err := s.ChannelMessageSend(channelID, fmt.Sprintf("<@%s> turn!", g.turn())); err != nil {
+	c.watchClock(g, s, channelID)
+	turn := fmt.Sprintf("<@%s> turn!", g.turn())
+	if cl := g.clockString(); cl != "" {
+		turn += " " + cl
+	}
+	if _, err := s.ChannelMessageSend(channelID, turn); err != nil {
 		return err
 	}
 
 	// Bot move area
-	if s.State.User.ID != g.turn() {
+	if s.BotID() != g.turn() {
 		return nil
 	}
-	err := g.eng.Run(
-		uci.CmdPosition{Position: g.Position()},
-		uci.CmdGo{MoveTime: time.Second / 10},
-	)
+	start := time.Now()
+	move, _, err := g.eng.Search(g.Position(), time.Second/10)
 	if err != nil {
 		return err
 	}
-	if err := g.Move(g.eng.SearchResults().BestMove); err != nil {
+	c.metrics.engine.observe(time.Since(start))
+	san := chess.AlgebraicNotation{}.Encode(g.Position(), move)
+	if err := g.Move(move); err != nil {
 		return err
 	}
+	c.audit(g, s.BotID(), auditMove, san)
 	// yeah check again cause bot moved, unless we are running @bot @bot
 	// which is virtually impossible, this should be safe
 	return c.checkOutcome(g, s, channelID)
 }
 
+// watchClock starts the clock once the board is sent and ends the game
+// when the player to move runs out of time.
+func (c *ChessHandler) watchClock(g *game, s Session, channelID string) {
+	if g.clock == nil {
+		return
+	}
+	now := time.Now().UTC()
+	g.clock.start(now)
+	turn := g.Position().Turn()
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.timer = time.AfterFunc(g.clock.remaining(turn, turn, now), func() {
+		if !c.begin() {
+			return
+		}
+		defer c.inflight.Done()
+
+		g.lock()
+		defer g.unlock()
+		// a move or the end of the game beat the timer
+		if c.states.game(channelID) != g || !g.flagged() {
+			return
+		}
+		c.audit(g, g.turn(), auditTimeout, "")
+		if err := c.checkOutcome(g, s, channelID); err != nil {
+			c.log.error("failed to end the game on time", err, "game", g.id)
+		}
+	})
+}
+
+// resumeClock starts the clock of a restored game, it stays stopped until
+// the board is shown again.
+func (c *ChessHandler) resumeClock(g *game, s Session, channelID string) {
+	if g.clock != nil && g.clock.turnStart.IsZero() {
+		c.watchClock(g, s, channelID)
+	}
+}
+
 // GameOver sends game finish Card.
-func (c *ChessHandler) GameOver(g *game, s *discordgo.Session, channelID string) error {
+func (c *ChessHandler) GameOver(g *game, s Session, channelID string) error {
 	defer c.states.done(channelID)
+	c.publish(g, s)
+	c.notifyGameOver(g, c.recordResult(g, s.BotID()))
+	c.audit(g, "", auditGameOver, fmt.Sprintf("%s %s: %s", g.Outcome(), g.methodString(), strings.TrimSpace(g.String())))
+	c.metrics.gamesFinished.inc("outcome", g.Outcome().String(), "method", g.methodString())
 
 	var winner string
-	method := g.Method().String()
+	method := g.methodString()
+	if g.endedBy != "" {
+		method += fmt.Sprintf(" by <@%s>", g.endedBy)
+	}
 
 	whiteStatus, whiteEmoji := "draw", ""
 	blackStatus, blackEmoji := "draw", ""
+	if g.Outcome() == chess.NoOutcome {
+		whiteStatus, blackStatus = "aborted", "aborted"
+	}
 
 	switch g.Outcome() {
 	case chess.WhiteWon:
@@ -348,11 +359,7 @@ func (c *ChessHandler) GameOver(g *game, s *discordgo.Session, channelID string)
 		avatarurl = user.AvatarURL("128x128")
 	}
 
-	gi, err := c.boardGIF(g)
-	if err != nil {
-		return err
-	}
-	_, err = s.ChannelMessageSendEmbed(
+	_, err := s.ChannelMessageSendEmbed(
 		channelID,
 		&discordgo.MessageEmbed{
 			Title:       "Game over",
@@ -361,6 +368,9 @@ func (c *ChessHandler) GameOver(g *game, s *discordgo.Session, channelID string)
 			Thumbnail: &discordgo.MessageEmbedThumbnail{
 				URL: avatarurl,
 			},
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: "Game ID: " + g.id,
+			},
 			Fields: []*discordgo.MessageEmbedField{
 				{
 					Name:   whiteStatus,
@@ -384,113 +394,266 @@ func (c *ChessHandler) GameOver(g *game, s *discordgo.Session, channelID string)
 		return err
 	}
 
-	gifr, pw := io.Pipe()
-	go func() {
-		pw.CloseWithError(gif.EncodeAll(pw, gi))
-	}()
-
-	_, err = s.ChannelFileSend(channelID, "board.gif", gifr)
-	return err
+	return c.coolThing(g, s, channelID)
 }
 
-func (c *ChessHandler) coolThing(g *game, s *discordgo.Session, channelID string) error {
-	gi, err := c.boardGIF(g)
+// coolThing sends the game replay as a gif.
+func (c *ChessHandler) coolThing(g *game, s Session, channelID string) error {
+	buf := &bytes.Buffer{}
+	start := time.Now()
+	c.drawer.mu.Lock()
+	err := c.drawer.EncodeGIF(buf, replayFrames(g), chessimage.GIFOptions{
+		Delay:     150,
+		LastDelay: 500,
+		MaxBytes:  c.gifMaxBytes,
+	})
+	c.drawer.mu.Unlock()
 	if err != nil {
 		return err
 	}
-	pr, pw := io.Pipe()
-	go func() {
-		pw.CloseWithError(gif.EncodeAll(pw, gi))
-	}()
+	c.metrics.render.observe(time.Since(start), "kind", "gif")
 
-	_, err = s.ChannelFileSend(channelID, "board.gif", pr)
+	_, err = s.ChannelFileSend(channelID, "board.gif", buf)
 	return err
 }
 
 // Draw using the drawer :tada:
-func (c *ChessHandler) sendBoard(g *game, s *discordgo.Session, channelID string) error {
+func (c *ChessHandler) sendBoard(g *game, s Session, channelID string, marks ...chessimage.Mark) error {
+	c.resumeClock(g, s, channelID)
+	if c.textBoard {
+		return c.sendTextBoard(g, s, channelID)
+	}
+
 	pr, pw := io.Pipe()
 	defer pr.Close()
 
-	im, err := c.boardImage(g)
+	start := time.Now()
+	im, err := c.boardImage(g, s, marks...)
 	if err != nil {
 		return err
 	}
+	c.metrics.render.observe(time.Since(start), "kind", "board")
 	go func() {
 		pw.CloseWithError(png.Encode(pw, im))
 	}()
 
-	if _, err := s.ChannelFileSend(channelID, "board.png", pr); err != nil {
+	_, err = s.ChannelFileSend(channelID, "board.png", pr)
+	return err
+}
+
+// sendTextBoard sends the board drawn with unicode pieces.
+func (c *ChessHandler) sendTextBoard(g *game, s Session, channelID string) error {
+	_, err := s.ChannelMessageSend(
+		channelID,
+		fmt.Sprintf("```\n%s\n```\n", g.Position().Board().Draw()),
+	)
+	return err
+}
+
+// sendBoardSVG sends the board as an svg file.
+func (c *ChessHandler) sendBoardSVG(g *game, s Session, channelID string, marks ...chessimage.Mark) error {
+	c.resumeClock(g, s, channelID)
+	drawer, err := c.drawerFor(g.turn())
+	if err != nil {
 		return err
 	}
+	buf := &bytes.Buffer{}
+	drawer.mu.Lock()
+	err = drawer.SVG(buf, g.Position().String(), c.boardMarks(g, marks...)...)
+	drawer.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = s.ChannelFileSend(channelID, "board.svg", buf)
+	return err
+}
 
+func (c *ChessHandler) boardImage(g *game, s Session, extra ...chessimage.Mark) (*image.RGBA, error) {
+	drawer, err := c.drawerFor(g.turn())
+	if err != nil {
+		return nil, err
+	}
+	panel := c.panel(g, s)
+	panel.Moves = movesNotation(g)
+	panel.Current = len(panel.Moves) - 1
 	if o := book.Find(g.Moves()); o != nil {
-		_, err = s.ChannelMessageSend(channelID, o.Title())
+		panel.Opening = o.Title()
 	}
-	return err
+	if g.evalBar && g.eng != nil && g.Outcome() == chess.NoOutcome {
+		e, err := g.evaluate()
+		if err != nil {
+			return nil, err
+		}
+		panel.Eval = e
+	}
+	drawer.mu.Lock()
+	defer drawer.mu.Unlock()
+	return drawer.ImagePanel(g.Position().String(), panel, c.boardMarks(g, extra...)...)
+}
+
+// movesNotation returns the game moves in algebraic notation.
+func movesNotation(g *game) []string {
+	enc := chess.AlgebraicNotation{}
+	positions := g.Positions()
+	res := make([]string, 0, len(g.Moves()))
+	for i, m := range g.Moves() {
+		res = append(res, enc.Encode(positions[i], m))
+	}
+	return res
 }
 
-func (c *ChessHandler) boardImage(g *game) (*image.RGBA, error) {
-	markColor := color.RGBA{55, 55, 155, 100}
+// panel returns the players info for the board panel, fetched once per game.
+func (c *ChessHandler) panel(g *game, s Session) chessimage.Panel {
+	g.panelOnce.Do(func() {
+		g.panel.White = c.playerInfo(s, g.whiteID)
+		g.panel.Black = c.playerInfo(s, g.blackID)
+	})
+	return g.panel
+}
+
+// playerInfo fetches the user name and avatar, on failure it falls back to
+// the user ID without avatar.
+func (c *ChessHandler) playerInfo(s Session, userID string) chessimage.Player {
+	p := chessimage.Player{Name: userID}
+	u, err := s.User(userID)
+	if err != nil {
+		c.log.error("failed to fetch user", err, "user", userID)
+		return p
+	}
+	p.Name = u.Username
+	if p.Avatar, err = s.UserAvatarDecode(u); err != nil {
+		c.log.error("failed to fetch avatar", err, "user", userID)
+	}
+	return p
+}
+
+// sharedDrawer is a drawer shared by the commands and web requests running
+// concurrently, mu must be held while rendering as its font faces aren't
+// safe for concurrent use.
+type sharedDrawer struct {
+	*chessimage.Drawer
+	mu sync.Mutex
+}
+
+// drawerFor returns the drawer with the theme preferred by the user.
+func (c *ChessHandler) drawerFor(userID string) (*sharedDrawer, error) {
+	name := c.prefs.theme(userID)
+	if name == "" {
+		name = c.defaultTheme
+	}
+	t, ok := c.themes[name]
+	if !ok {
+		return c.drawer, nil
+	}
+
+	c.drawersMu.Lock()
+	defer c.drawersMu.Unlock()
+
+	if d, ok := c.drawers[name]; ok {
+		return d, nil
+	}
+	d, err := chessimage.NewDrawer(
+		chessimage.WithTheme(t),
+		chessimage.WithMoveList(moveListRows),
+	)
+	if err != nil {
+		return nil, err
+	}
+	sd := &sharedDrawer{Drawer: d}
+	c.drawers[name] = sd
+	return sd, nil
+}
+
+// boardMarks returns the last move and check marks for the current position
+// followed by extra.
+func (c *ChessHandler) boardMarks(g *game, extra ...chessimage.Mark) []chessimage.Mark {
 	marks := []chessimage.Mark{}
+	if moves := g.Moves(); len(moves) != 0 {
+		marks = chessimage.LastMoveMarks(moves[len(moves)-1], g.Position())
+	}
+	return append(marks, extra...)
+}
 
-	moves := g.Moves()
-	if len(moves) != 0 {
-		last := moves[len(moves)-1]
-		marks = []chessimage.Mark{
-			{
-				Color: markColor,
-				Pos: [][2]int{
-					{int(last.S1().File()), 7 - int(last.S1().Rank())},
-					{int(last.S2().File()), 7 - int(last.S2().Rank())},
-				},
-			},
+// moveHints returns the marks highlighting the piece on sq and dotting each
+// of its legal destination squares.
+func moveHints(g *game, sq chess.Square) []chessimage.Mark {
+	dots := [][2]int{}
+	for _, m := range g.ValidMoves() {
+		if m.S1() == sq {
+			dots = append(dots, chessimage.SquarePos(m.S2()))
 		}
 	}
-	return c.drawer.Image(g.Position().String(), marks...)
+	if len(dots) == 0 {
+		return nil
+	}
+	return []chessimage.Mark{
+		{
+			Color: color.NRGBA{155, 155, 55, 100},
+			Pos:   [][2]int{chessimage.SquarePos(sq)},
+		},
+		{
+			Style: chessimage.MarkDot,
+			Color: color.NRGBA{40, 40, 40, 110},
+			Pos:   dots,
+		},
+	}
 }
 
-func (c *ChessHandler) boardGIF(g *game) (*gif.GIF, error) {
-	gi := gif.GIF{
-		Config: image.Config{
-			Width:  512,
-			Height: 512,
-		},
+// annotationMarks parses a list of arrows "e2e4" and circles "e4" into marks.
+func annotationMarks(args []string) ([]chessimage.Mark, error) {
+	marks, err := chessimage.ParseAnnotations(args)
+	if err != nil {
+		msg := err.Error()
+		return nil, GameError(strings.ToUpper(msg[:1]) + msg[1:])
 	}
+	return marks, nil
+}
 
-	markColor := color.RGBA{100, 100, 200, 255}
-	moves := g.Moves()
-	gg := chess.NewGame()
-	frame, err := c.drawer.ImagePaletted(gg.Position().String())
+// sendAPNG sends the game replay as an animated png with the pieces sliding,
+// drawn with the theme of userID.
+func (c *ChessHandler) sendAPNG(g *game, s Session, channelID, userID string) error {
+	drawer, err := c.drawerFor(userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	gi.Image = append(gi.Image, frame)
-	gi.Delay = append(gi.Delay, 150)
 
-	for i, m := range moves {
+	buf := &bytes.Buffer{}
+	drawer.mu.Lock()
+	err = drawer.EncodeAPNG(buf, replayFrames(g), chessimage.APNGOptions{
+		Delay:      100,
+		LastDelay:  500,
+		Slide:      8,
+		SlideDelay: 3,
+		MaxBytes:   c.gifMaxBytes,
+	})
+	drawer.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.ChannelFileSend(channelID, "replay.png", buf)
+	return err
+}
+
+// replayFrames returns a frame for each position of the game with the move
+// marked.
+func replayFrames(g *game) []chessimage.Frame {
+	markColor := color.RGBA{100, 100, 200, 255}
+	gg := chess.NewGame()
+	frames := []chessimage.Frame{{FEN: gg.Position().String()}}
+	for _, m := range g.Moves() {
 		gg.Move(m)
-		frame, err := c.drawer.ImagePaletted(
-			gg.Position().String(),
-			chessimage.Mark{
+		move := [][2]int{chessimage.SquarePos(m.S1()), chessimage.SquarePos(m.S2())}
+		frames = append(frames, chessimage.Frame{
+			FEN: gg.Position().String(),
+			Marks: []chessimage.Mark{{
 				Color: markColor,
-				Pos: [][2]int{
-					{int(m.S1().File()), 7 - int(m.S1().Rank())},
-					{int(m.S2().File()), 7 - int(m.S2().Rank())},
-				},
-			},
-		)
-		if err != nil {
-			return nil, err
-		}
-		gi.Image = append(gi.Image, frame)
-		delay := 150
-		if i == len(moves)-1 {
-			delay = 500
-		}
-		gi.Delay = append(gi.Delay, delay)
+				Pos:   move,
+			}},
+			Move: move,
+		})
 	}
-	return &gi, nil
+	return frames
 }
 
 func validMovesStr(g *game) string {
@@ -0,0 +1,725 @@
+package discordchess
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/bwmarrin/discordgo"
+	"github.com/notnil/chess"
+)
+
+const testChannel = "channel"
+
+func TestMain(m *testing.M) {
+	// the avatars fail to load on the fake session
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+var (
+	mentionRE = regexp.MustCompile(`<@(\w+)>`)
+	roleRE    = regexp.MustCompile(`<@&(\w+)>`)
+)
+
+// step is a message sent to the handler.
+type step struct {
+	author  string
+	content string
+	roles   []string
+}
+
+func (st step) message(id int) *discordgo.MessageCreate {
+	m := &discordgo.Message{
+		ID:        string(rune('a' + id)),
+		ChannelID: testChannel,
+		GuildID:   "guild",
+		Content:   st.content,
+		Author:    &discordgo.User{ID: st.author},
+		Member:    &discordgo.Member{Roles: st.roles},
+	}
+	for _, sm := range mentionRE.FindAllStringSubmatch(st.content, -1) {
+		m.Mentions = append(m.Mentions, &discordgo.User{ID: sm[1]})
+	}
+	for _, sm := range roleRE.FindAllStringSubmatch(st.content, -1) {
+		m.MentionRoles = append(m.MentionRoles, sm[1])
+	}
+	return &discordgo.MessageCreate{Message: m}
+}
+
+// moves returns a step per move alternating white and black from white.
+func moves(ms ...string) []step {
+	res := []step{}
+	for i, m := range ms {
+		author := "white"
+		if i%2 == 1 {
+			author = "black"
+		}
+		res = append(res, step{author: author, content: "!move " + m})
+	}
+	return res
+}
+
+func steps(groups ...[]step) []step {
+	res := []step{}
+	for _, g := range groups {
+		res = append(res, g...)
+	}
+	return res
+}
+
+var start = []step{{author: "white", content: "!play <@white> <@black>"}}
+
+func TestMessageCreateHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+		// sends expected after the last step, in order but not necessarily
+		// consecutive
+		want []sent
+		// outcome and method of the game, NoOutcome if still in progress,
+		// ending is the method of the endings chess doesn't know about
+		outcome chess.Outcome
+		method  chess.Method
+		ending  string
+		// moves played if the game is in progress
+		moves int
+		// removed games are dropped without ending
+		removed bool
+	}{
+		{
+			name:  "start",
+			steps: start,
+			want: []sent{
+				{"reaction", testChannel, "✅"},
+				{"file", testChannel, "board.png"},
+				{"message", testChannel, "<@white> turn!"},
+			},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:  "move",
+			steps: steps(start, moves("e4")),
+			want: []sent{
+				{"reaction", testChannel, "✅"},
+				{"file", testChannel, "board.png"},
+				{"message", testChannel, "<@black> turn!"},
+			},
+			outcome: chess.NoOutcome,
+			moves:   1,
+		},
+		{
+			name:    "wrong turn",
+			steps:   steps(start, []step{{author: "black", content: "!move e5"}}),
+			want:    []sent{{"reaction", testChannel, "❌"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:    "invalid move",
+			steps:   steps(start, moves("e5")),
+			want:    []sent{{"reaction", testChannel, "❌"}, {"reply", testChannel, "Invalid move"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:  "no game",
+			steps: moves("e4"),
+			want:  []sent{{"reaction", testChannel, "❌"}, {"reply", testChannel, string(ErrNoGame)}},
+		},
+		{
+			name:    "game in progress",
+			steps:   steps(start, start),
+			want:    []sent{{"reply", testChannel, "Game in Process <@white> vs <@black>"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:  "checkmate",
+			steps: steps(start, moves("f3", "e5", "g4", "Qh4")),
+			want: []sent{
+				{"file", testChannel, "board.png"},
+				{"embed", testChannel, "Checkmate"},
+				{"file", testChannel, "board.gif"},
+			},
+			outcome: chess.BlackWon,
+			method:  chess.Checkmate,
+		},
+		{
+			name:  "resign",
+			steps: steps(start, moves("e4"), []step{{author: "black", content: "!resign"}}),
+			want: []sent{
+				{"embed", testChannel, "Resignation"},
+				{"file", testChannel, "board.gif"},
+			},
+			outcome: chess.WhiteWon,
+			method:  chess.Resignation,
+		},
+		{
+			name: "draw offer",
+			steps: steps(start, moves("e4"), []step{
+				{author: "white", content: "!draw"},
+			}),
+			want: []sent{
+				{"reaction", testChannel, "✅"},
+				{"message", testChannel, "<@black> send `!draw` to accept"},
+			},
+			outcome: chess.NoOutcome,
+			moves:   1,
+		},
+		{
+			name: "draw accepted",
+			steps: steps(start, moves("e4"), []step{
+				{author: "white", content: "!draw"},
+				{author: "black", content: "!draw"},
+			}),
+			want:    []sent{{"embed", testChannel, "DrawOffer"}},
+			outcome: chess.Draw,
+			method:  chess.DrawOffer,
+		},
+		{
+			name: "draw offer cleared by move",
+			steps: steps(start, []step{
+				{author: "white", content: "!draw"},
+				{author: "white", content: "!move e4"},
+				{author: "black", content: "!draw"},
+			}),
+			want:    []sent{{"message", testChannel, "<@white> send `!draw` to accept"}},
+			outcome: chess.NoOutcome,
+			moves:   1,
+		},
+		{
+			name:    "cancel without role",
+			steps:   steps(start, []step{{author: "someone", content: "!cancel"}}),
+			want:    []sent{{"reaction", testChannel, "❌"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name: "cancel by admin",
+			steps: steps(start, []step{
+				{author: "someone", content: "!cancel", roles: []string{"admin"}},
+			}),
+			want:    []sent{{"embed", testChannel, "Aborted by <@someone>"}, {"file", testChannel, "board.gif"}},
+			outcome: chess.NoOutcome,
+			ending:  methodAborted,
+		},
+		{
+			name: "abort by owner",
+			steps: steps(start, []step{
+				{author: "owner", content: "!abort"},
+			}),
+			want:    []sent{{"embed", testChannel, "Aborted by <@owner>"}},
+			outcome: chess.NoOutcome,
+			ending:  methodAborted,
+		},
+		{
+			name: "adjudicate by channel moderator",
+			steps: steps(start, moves("e4"), []step{
+				{author: "someone", content: "!adjudicate black", roles: []string{"helper"}},
+			}),
+			want:    []sent{{"embed", testChannel, "Adjudicated by <@someone>"}},
+			outcome: chess.BlackWon,
+			ending:  methodAdjudicated,
+		},
+		{
+			name: "adjudicate draw by administrator",
+			steps: steps(start, []step{
+				{author: "someone", content: "!adjudicate draw", roles: []string{"boss"}},
+			}),
+			want:    []sent{{"embed", testChannel, "Adjudicated by <@someone>"}},
+			outcome: chess.Draw,
+			ending:  methodAdjudicated,
+		},
+		{
+			name: "adjudicate denied by member overwrite",
+			steps: steps(start, []step{
+				{author: "muted", content: "!adjudicate white", roles: []string{"helper"}},
+			}),
+			want:    []sent{{"reaction", testChannel, "❌"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name: "kick game",
+			steps: steps(start, []step{
+				{author: "someone", content: "!kick-game", roles: []string{"helper"}},
+			}),
+			want:    []sent{{"message", testChannel, "Game <@white> vs <@black> removed by <@someone>"}},
+			outcome: chess.NoOutcome,
+			removed: true,
+		},
+		{
+			name:  "config by manager",
+			steps: []step{{author: "someone", content: "!config set level 3", roles: []string{"manager"}}},
+			want:  []sent{{"reaction", testChannel, "✅"}},
+		},
+		{
+			name:  "config denied to channel moderator",
+			steps: []step{{author: "someone", content: "!config set level 3", roles: []string{"helper"}}},
+			want:  []sent{{"reaction", testChannel, "❌"}},
+		},
+		{
+			name:  "bot move",
+			steps: []step{{author: "white", content: "!play <@white> <@bot>"}, {author: "white", content: "!move e4"}},
+			want: []sent{
+				{"file", testChannel, "board.png"},
+				{"message", testChannel, "<@bot> turn!"},
+				{"file", testChannel, "board.png"},
+				{"message", testChannel, "<@white> turn!"},
+			},
+			outcome: chess.NoOutcome,
+			moves:   2,
+		},
+		{
+			name:  "bot opens",
+			steps: []step{{author: "white", content: "!play <@bot> <@black>"}},
+			want: []sent{
+				{"message", testChannel, "Trying to play with AI"},
+				{"message", testChannel, "<@bot> turn!"},
+				{"message", testChannel, "<@black> turn!"},
+			},
+			outcome: chess.NoOutcome,
+			moves:   1,
+		},
+		{
+			name: "bot resign",
+			steps: []step{
+				{author: "white", content: "!play <@white> <@bot>"},
+				{author: "white", content: "!move e4"},
+				{author: "white", content: "!resign"},
+			},
+			want:    []sent{{"embed", testChannel, "Resignation"}},
+			outcome: chess.BlackWon,
+			method:  chess.Resignation,
+		},
+		{
+			name:    "board hints",
+			steps:   steps(start, []step{{author: "black", content: "!board e2"}}),
+			want:    []sent{{"file", testChannel, "board.png"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:    "board svg first",
+			steps:   steps(start, []step{{author: "black", content: "!board svg e2"}}),
+			want:    []sent{{"file", testChannel, "board.svg"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:    "board two squares",
+			steps:   steps(start, []step{{author: "black", content: "!board e2 d2"}}),
+			want:    []sent{{"reply", testChannel, "Usage: `!board [square] [svg]`, one square at a time"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:  "help",
+			steps: []step{{author: "white", content: "!help"}},
+			want:  []sent{{"message", testChannel, "Help:"}},
+		},
+		{
+			name:  "command help",
+			steps: []step{{author: "white", content: "!help m"}},
+			want:  []sent{{"message", testChannel, "`!move [move]` - do a move"}},
+		},
+		{
+			name:  "did you mean",
+			steps: []step{{author: "white", content: "!mvoe e4"}},
+			want:  []sent{{"reaction", testChannel, "❌"}, {"reply", testChannel, "Unknown command `!mvoe`, did you mean `!move`?"}},
+		},
+		{
+			name:  "unknown command",
+			steps: []step{{author: "white", content: "!ping"}},
+			want:  nil,
+		},
+		{
+			name:    "usage",
+			steps:   steps(start, []step{{author: "white", content: "!evalbar maybe"}}),
+			want:    []sent{{"reply", testChannel, "Usage: `!evalbar on|off`"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name: "config prefix",
+			steps: []step{
+				{author: "admin", content: "!config set prefix ?", roles: []string{"admin"}},
+				{author: "white", content: "?help"},
+			},
+			want: []sent{{"message", testChannel, "Help:\n  `?help"}},
+		},
+		{
+			name: "config old prefix",
+			steps: []step{
+				{author: "admin", content: "!config set prefix ?", roles: []string{"admin"}},
+				{author: "white", content: "!help"},
+			},
+			want: nil,
+		},
+		{
+			name: "config rooms",
+			steps: []step{
+				{author: "admin", content: "!config set rooms ^general$", roles: []string{"admin"}},
+				start[0],
+			},
+			want: []sent{{"reply", testChannel, "wrong room"}},
+		},
+		{
+			name: "config invalid rooms",
+			steps: []step{
+				{author: "admin", content: "!config set rooms (", roles: []string{"admin"}},
+			},
+			want: []sent{{"reply", testChannel, "Invalid rooms regexp"}},
+		},
+		{
+			name:  "config denied",
+			steps: []step{{author: "white", content: "!config set prefix ?"}},
+			want:  []sent{{"reaction", testChannel, "❌"}},
+		},
+		{
+			name: "config admin role",
+			steps: steps(start, []step{
+				{author: "admin", content: "!config admin-role add <@&mod>", roles: []string{"admin"}},
+				{author: "someone", content: "!abort", roles: []string{"mod"}},
+			}),
+			want:    []sent{{"embed", testChannel, "Aborted"}},
+			outcome: chess.NoOutcome,
+			ending:  methodAborted,
+		},
+		{
+			name: "config show",
+			steps: []step{
+				{author: "admin", content: "!config set time 5+3", roles: []string{"admin"}},
+				{author: "admin", content: "!config", roles: []string{"admin"}},
+			},
+			want: []sent{{"message", testChannel, "Prefix: `!`\nRooms: `^chess$`\nAdmin roles: <@&admin>\nBot level: 20\nTime control: 5+3"}},
+		},
+		{
+			name: "timed game",
+			steps: []step{
+				{author: "admin", content: "!config set time 5+3", roles: []string{"admin"}},
+				start[0],
+			},
+			want:    []sent{{"message", testChannel, "<@white> turn! ⏱ white 5:00, black 5:00"}},
+			outcome: chess.NoOutcome,
+		},
+		{
+			name:    "alias",
+			steps:   steps(start, []step{{author: "white", content: "!m e4"}}),
+			want:    []sent{{"message", testChannel, "<@black> turn!"}},
+			outcome: chess.NoOutcome,
+			moves:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New("!", "^chess$", []string{"guild:admin"}, WithEngine(func(int) (Engine, error) {
+				return firstMoveEngine{}, nil
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newFakeSession("bot")
+
+			var g *game
+			for i, st := range tt.steps {
+				if i == len(tt.steps)-1 {
+					s.reset()
+				}
+				c.HandleMessage(s, st.message(i))
+				if cur := c.states.game(testChannel); cur != nil {
+					g = cur
+				}
+			}
+
+			got := s.reset()
+			if tt.want == nil && len(got) != 0 {
+				t.Errorf("sends %v, want none", got)
+			}
+			if !containsSends(got, tt.want) {
+				t.Errorf("sends\n%v\nwant in order\n%v", got, tt.want)
+			}
+
+			if g == nil {
+				return
+			}
+			if o := g.Outcome(); o != tt.outcome {
+				t.Errorf("outcome %s, want %s", o, tt.outcome)
+			}
+			if g.over() {
+				switch {
+				case tt.ending != "":
+					if m := g.methodString(); m != tt.ending {
+						t.Errorf("method %s, want %s", m, tt.ending)
+					}
+				case g.Method() != tt.method:
+					t.Errorf("method %s, want %s", g.Method(), tt.method)
+				}
+				if c.states.game(testChannel) != nil {
+					t.Error("finished game still in progress")
+				}
+				return
+			}
+			if removed := c.states.game(testChannel) == nil; removed != tt.removed {
+				t.Errorf("removed %v, want %v", removed, tt.removed)
+			}
+			if n := len(g.Moves()); n != tt.moves {
+				t.Errorf("%d moves, want %d", n, tt.moves)
+			}
+		})
+	}
+}
+
+func TestWrongRoom(t *testing.T) {
+	c, err := New("!", "^chess$", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	s.channels[testChannel] = &discordgo.Channel{ID: testChannel, Name: "general"}
+
+	c.HandleMessage(s, start[0].message(0))
+	want := []sent{{"reaction", testChannel, "❌"}, {"reply", testChannel, "wrong room"}}
+	if got := s.reset(); !containsSends(got, want) {
+		t.Errorf("sends %v, want %v", got, want)
+	}
+	if c.states.game(testChannel) != nil {
+		t.Error("game started in the wrong room")
+	}
+}
+
+func TestInvalidRooms(t *testing.T) {
+	if _, err := New("!", "chess-(", nil); err == nil {
+		t.Error("want an error for the invalid rooms regexp")
+	}
+}
+
+// containsSends reports whether want is a subsequence of got, contents
+// match by prefix.
+func containsSends(got, want []sent) bool {
+	i := 0
+	for _, g := range got {
+		if i == len(want) {
+			break
+		}
+		w := want[i]
+		if g.kind == w.kind && g.channelID == w.channelID && strings.HasPrefix(g.content, w.content) {
+			i++
+		}
+	}
+	return i == len(want)
+}
+
+func TestTimeout(t *testing.T) {
+	for _, st := range []step{
+		{author: "white", content: "!move e4"},
+		// the player waiting ends the game as well
+		{author: "black", content: "!board"},
+	} {
+		c, err := New("!", "", []string{"guild:admin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newFakeSession("bot")
+		c.HandleMessage(s, step{author: "admin", content: "!config set time 1+0", roles: []string{"admin"}}.message(0))
+		c.HandleMessage(s, start[0].message(1))
+		g := c.states.game(testChannel)
+		if g == nil || g.clock == nil {
+			t.Fatal("timed game not started")
+		}
+
+		// white thought for too long
+		g.lock()
+		g.clock.turnStart = g.clock.turnStart.Add(-2 * time.Minute)
+		g.unlock()
+		s.reset()
+		c.HandleMessage(s, st.message(2))
+
+		want := []sent{{"embed", testChannel, "Timeout"}}
+		if got := s.reset(); !containsSends(got, want) {
+			t.Errorf("%s: sends %v, want %v", st.content, got, want)
+		}
+		if g.Outcome() != chess.BlackWon {
+			t.Errorf("%s: outcome %s, want %s", st.content, g.Outcome(), chess.BlackWon)
+		}
+	}
+}
+
+func TestClockTimer(t *testing.T) {
+	c, err := New("!", "", []string{"guild:admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	c.HandleMessage(s, step{author: "admin", content: "!config set time 1+0", roles: []string{"admin"}}.message(0))
+	c.HandleMessage(s, start[0].message(1))
+	g := c.states.game(testChannel)
+	if g == nil || g.clock == nil {
+		t.Fatal("timed game not started")
+	}
+
+	// nobody sends a command, the timer ends the game
+	g.lock()
+	g.clock.left[chess.White] = 10 * time.Millisecond
+	c.watchClock(g, s, testChannel)
+	g.unlock()
+	for i := 0; i < 100 && c.states.game(testChannel) != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.states.game(testChannel) != nil {
+		t.Fatal("game still in progress after white's time ran out")
+	}
+
+	g.lock()
+	defer g.unlock()
+	if g.Outcome() != chess.BlackWon || g.method != methodTimeout {
+		t.Errorf("game ended %s %s, want %s on time", g.Outcome(), g.methodString(), chess.BlackWon)
+	}
+	want := []sent{{"embed", testChannel, "Timeout"}}
+	if got := s.reset(); !containsSends(got, want) {
+		t.Errorf("sends %v, want %v", got, want)
+	}
+}
+
+func TestBoardsParallel(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	channels := []string{testChannel, "other"}
+	send := func(channelID string, st step, i int) {
+		m := st.message(i)
+		m.ChannelID = channelID
+		c.HandleMessage(s, m)
+	}
+	for _, ch := range channels {
+		for i, st := range steps(start, moves("e4")) {
+			send(ch, st, i)
+		}
+	}
+	s.reset()
+
+	// both games render with the default drawer at once
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		for _, ch := range channels {
+			wg.Add(1)
+			go func(ch string, i int) {
+				defer wg.Done()
+				send(ch, step{author: "black", content: "!board"}, i)
+			}(ch, i)
+		}
+	}
+	wg.Wait()
+	boards := 0
+	for _, sn := range s.reset() {
+		if sn.kind == "file" && sn.content == "board.png" {
+			boards++
+		}
+	}
+	if boards != 4*len(channels) {
+		t.Errorf("sent %d boards, want %d", boards, 4*len(channels))
+	}
+}
+
+func TestBoardMarks(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGame("guild", testChannel, "white", "black", nil, timeControl{})
+	defer g.Close()
+	if marks := c.boardMarks(g); len(marks) != 0 {
+		t.Errorf("marks before the first move = %v", marks)
+	}
+	for _, m := range []string{"e4", "f5", "Qh5"} {
+		if err := g.MoveStr(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	marks := c.boardMarks(g)
+	if len(marks) != 2 || marks[0].Pos[0] != [2]int{3, 7} || marks[0].Pos[1] != [2]int{7, 3} {
+		t.Fatalf("marks = %v, want the last move d1h5 and the check", marks)
+	}
+	if marks[1].Style != chessimage.MarkCheck || marks[1].Pos[0] != [2]int{4, 0} {
+		t.Errorf("check mark = %v, want the black king on e8", marks[1])
+	}
+
+	tests := []struct {
+		square string
+		dots   int
+	}{
+		{"g7", 1}, // only g6 blocks the check
+		{"e8", 0}, // the king is stuck
+		{"a7", 0},
+	}
+	for _, tt := range tests {
+		sq, _ := chessimage.ParseSquare(tt.square)
+		hints := moveHints(g, sq)
+		if tt.dots == 0 {
+			if hints != nil {
+				t.Errorf("hints of %s = %v, want none", tt.square, hints)
+			}
+			continue
+		}
+		if len(hints) != 2 || hints[1].Style != chessimage.MarkDot || len(hints[1].Pos) != tt.dots {
+			t.Errorf("hints of %s = %v, want %d dots", tt.square, hints, tt.dots)
+		}
+	}
+}
+
+func TestAnnotationMarks(t *testing.T) {
+	marks, err := annotationMarks([]string{"e2e4", "G1F3", "d5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{4, 6}, {4, 4}, {6, 7}, {5, 5}}
+	if marks[0].Style != chessimage.MarkArrow || len(marks[0].Pos) != len(want) {
+		t.Fatalf("arrows = %v, want %v", marks[0], want)
+	}
+	for i, p := range want {
+		if marks[0].Pos[i] != p {
+			t.Errorf("arrow point %d = %v, want %v", i, marks[0].Pos[i], p)
+		}
+	}
+	if marks[1].Style != chessimage.MarkCircle || len(marks[1].Pos) != 1 || marks[1].Pos[0] != [2]int{3, 3} {
+		t.Errorf("circles = %v, want d5", marks[1])
+	}
+	for _, args := range [][]string{{"e2e2"}, {"z9"}, {"e2e"}} {
+		if _, err := annotationMarks(args); err == nil {
+			t.Errorf("annotationMarks(%q) succeeded", args)
+		}
+	}
+}
+
+// countingEngine counts the searches.
+type countingEngine struct {
+	firstMoveEngine
+	searches int
+}
+
+func (e *countingEngine) Search(pos *chess.Position, d time.Duration) (*chess.Move, chessimage.Eval, error) {
+	e.searches++
+	m, _, err := e.firstMoveEngine.Search(pos, d)
+	return m, chessimage.Eval{CP: e.searches}, err
+}
+
+func TestEvaluateCached(t *testing.T) {
+	eng := &countingEngine{}
+	g := newGame("guild", testChannel, "white", "bot", eng, timeControl{})
+	for i := 0; i < 3; i++ {
+		e, err := g.evaluate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.CP != 1 {
+			t.Errorf("evaluation %d = %+v, want the first one", i, e)
+		}
+	}
+	if err := g.MoveStr("e4"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := g.evaluate(); e.CP != 2 || eng.searches != 2 {
+		t.Errorf("evaluation after a move = %+v with %d searches, want a new search", e, eng.searches)
+	}
+}
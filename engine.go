@@ -0,0 +1,84 @@
+package discordchess
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/notnil/chess"
+	"github.com/notnil/chess/uci"
+)
+
+// Engine plays the bot moves.
+type Engine interface {
+	// Search searches pos for d and returns the best move and the
+	// evaluation from white's point of view.
+	Search(pos *chess.Position, d time.Duration) (*chess.Move, chessimage.Eval, error)
+	Close() error
+}
+
+// uciEngine is an Engine backed by an uci engine process, mu serializes
+// the commands sent to the process.
+type uciEngine struct {
+	eng *uci.Engine
+	mu  sync.Mutex
+}
+
+// NewUCIEngine starts the uci engine at path, i.e: "stockfish", with the
+// skill level from 0 to 20, options are set before the level, i.e: "Threads"
+// or "Hash".
+func NewUCIEngine(path string, level int, options map[string]string) (Engine, error) {
+	e, err := uci.New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cmds := []uci.Cmd{uci.CmdUCI}
+	for _, name := range names {
+		cmds = append(cmds, uci.CmdSetOption{Name: name, Value: options[name]})
+	}
+	cmds = append(cmds,
+		uci.CmdSetOption{Name: "Skill Level", Value: strconv.Itoa(level)},
+		uci.CmdIsReady,
+		uci.CmdUCINewGame,
+	)
+	err = e.Run(cmds...)
+	if err != nil {
+		e.Close()
+		return nil, err
+	}
+	return &uciEngine{eng: e}, nil
+}
+
+func (e *uciEngine) Search(pos *chess.Position, d time.Duration) (*chess.Move, chessimage.Eval, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	err := e.eng.Run(
+		uci.CmdPosition{Position: pos},
+		uci.CmdGo{MoveTime: d},
+	)
+	if err != nil {
+		return nil, chessimage.Eval{}, err
+	}
+	res := e.eng.SearchResults()
+	ev := chessimage.Eval{CP: res.Info.Score.CP, Mate: res.Info.Score.Mate}
+	if pos.Turn() == chess.Black {
+		ev.CP, ev.Mate = -ev.CP, -ev.Mate
+	}
+	return res.BestMove, ev, nil
+}
+
+func (e *uciEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.eng.Close()
+}
@@ -1,15 +1,27 @@
 package discordchess
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/DiscordGophers/discordchess/chessimage"
 	"github.com/notnil/chess"
-	"github.com/notnil/chess/uci"
 )
 
 type game struct {
 	*chess.Game
 
+	// busy is held by the commands and the clock timer using the game
+	busy chan struct{}
+
+	// id identifies the game in the logs and the audit
+	id                 string
+	guildID, channelID string
+
 	whiteID, blackID string
 	// TODO: {lpf} this can be used later to bust the game if stuck
 	createdAt  time.Time
@@ -17,48 +29,199 @@ type game struct {
 
 	drawWhite bool
 	drawBlack bool
-	// optional uci engine
-	eng *uci.Engine
+
+	// players names and avatars for the board panel
+	panel     chessimage.Panel
+	panelOnce sync.Once
+	// optional engine playing the bot moves at botLevel
+	eng      Engine
+	botLevel int
+	// evalBar shows the engine evaluation next to the board, eval caches
+	// the evaluation of the position evalFEN
+	evalBar bool
+	eval    *chessimage.Eval
+	evalFEN string
+	evalMu  sync.Mutex
+
+	// optional clock of timed games, timer ends the game when the player
+	// to move runs out of time
+	clock *clock
+	timer *time.Timer
+	// method overrides the outcome method for endings the chess package
+	// doesn't know about, endedBy is the moderator that ended the game
+	method  string
+	endedBy string
 }
 
-func newGame(whiteID, blackID string, initUCI bool) (*game, error) {
-	var eng *uci.Engine
-	if initUCI {
-		e, err := uci.New("stockfish")
-		if err != nil {
-			return nil, err
-		}
-		if err := e.Run(uci.CmdUCI, uci.CmdIsReady, uci.CmdUCINewGame); err != nil {
-			return nil, err
-		}
-		eng = e
-	}
+// Endings not covered by chess.Method.
+const (
+	methodTimeout     = "Timeout"
+	methodAborted     = "Aborted"
+	methodAdjudicated = "Adjudicated"
+)
 
+func newGame(guildID, channelID, whiteID, blackID string, eng Engine, tc timeControl) *game {
 	g := &game{
+		id:        newGameID(),
+		guildID:   guildID,
+		channelID: channelID,
+
 		whiteID: whiteID,
 		blackID: blackID,
 
+		busy:       make(chan struct{}, 1),
 		eng:        eng,
 		createdAt:  time.Now().UTC(),
 		lastMoveAt: time.Now().UTC(),
 
 		Game: chess.NewGame(chess.UseNotation(chess.AlgebraicNotation{})),
 	}
-	return g, nil
+	if tc.Base > 0 {
+		g.clock = newClock(tc)
+	}
+	return g
+}
+
+// newGameID returns a random hex id.
+func newGameID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		// only used to tell games apart, the time will do
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// lock waits for the game to be free, unlock frees it.
+func (g *game) lock()   { g.busy <- struct{}{} }
+func (g *game) unlock() { <-g.busy }
+
+// tryLock locks the game if it is free.
+func (g *game) tryLock() bool {
+	select {
+	case g.busy <- struct{}{}:
+		return true
+	default:
+		return false
+	}
 }
 
 func (g *game) Close() {
+	if g.timer != nil {
+		g.timer.Stop()
+	}
 	if g.eng != nil {
 		g.eng.Close()
 	}
 }
 
+// evaluate returns the score of the current position from white's point of
+// view, the engine searches each position once.
+func (g *game) evaluate() (*chessimage.Eval, error) {
+	pos := g.Position()
+	fen := pos.String()
+
+	g.evalMu.Lock()
+	defer g.evalMu.Unlock()
+
+	if g.eval == nil || g.evalFEN != fen {
+		_, e, err := g.eng.Search(pos, time.Second/20)
+		if err != nil {
+			return nil, err
+		}
+		g.eval, g.evalFEN = &e, fen
+	}
+	e := *g.eval
+	return &e, nil
+}
+
 func (g *game) MoveStr(m string) error {
 	g.drawWhite = false
 	g.drawBlack = false
 
 	g.lastMoveAt = time.Now().UTC()
-	return g.Game.MoveStr(m)
+	turn := g.Position().Turn()
+	if err := g.Game.MoveStr(m); err != nil {
+		return err
+	}
+	g.punch(turn)
+	return nil
+}
+
+func (g *game) Move(m *chess.Move) error {
+	g.lastMoveAt = time.Now().UTC()
+	turn := g.Position().Turn()
+	if err := g.Game.Move(m); err != nil {
+		return err
+	}
+	g.punch(turn)
+	return nil
+}
+
+func (g *game) punch(c chess.Color) {
+	if g.clock != nil {
+		g.clock.punch(c, g.lastMoveAt)
+	}
+}
+
+// flagged ends the game if the player to move ran out of time.
+func (g *game) flagged() bool {
+	if g.clock == nil || g.Outcome() != chess.NoOutcome {
+		return false
+	}
+	turn := g.Position().Turn()
+	if g.clock.remaining(turn, turn, time.Now().UTC()) > 0 {
+		return false
+	}
+	g.Resign(turn)
+	g.method = methodTimeout
+	return true
+}
+
+// abort ends the game without a result.
+func (g *game) abort(moderatorID string) {
+	g.method = methodAborted
+	g.endedBy = moderatorID
+}
+
+// adjudicate ends the game with the outcome decided by a moderator.
+func (g *game) adjudicate(o chess.Outcome, moderatorID string) {
+	switch o {
+	case chess.WhiteWon:
+		g.Resign(chess.Black)
+	case chess.BlackWon:
+		g.Resign(chess.White)
+	case chess.Draw:
+		g.Draw(chess.DrawOffer)
+	}
+	g.method = methodAdjudicated
+	g.endedBy = moderatorID
+}
+
+// over reports whether the game ended, aborted games have no outcome.
+func (g *game) over() bool {
+	return g.Outcome() != chess.NoOutcome || g.method == methodAborted
+}
+
+// methodString returns how the game ended.
+func (g *game) methodString() string {
+	if g.method != "" {
+		return g.method
+	}
+	return g.Method().String()
+}
+
+// clockString returns the time left of each player, empty if untimed.
+func (g *game) clockString() string {
+	if g.clock == nil {
+		return ""
+	}
+	now, turn := time.Now().UTC(), g.Position().Turn()
+	return fmt.Sprintf(
+		"⏱ white %s, black %s",
+		formatClock(g.clock.remaining(chess.White, turn, now)),
+		formatClock(g.clock.remaining(chess.Black, turn, now)),
+	)
 }
 
 func (g *game) draw(id string) bool {
@@ -6,5 +6,9 @@ require (
 	github.com/bwmarrin/discordgo v0.23.2
 	github.com/joho/godotenv v1.3.0
 	github.com/notnil/chess v1.5.0
-	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
+	github.com/srwiley/oksvg v0.0.0-20210209000435-a757b9cbd472
+	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
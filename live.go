@@ -0,0 +1,239 @@
+package discordchess
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/notnil/chess"
+)
+
+// maxFinished is the number of finished games kept for replays.
+const maxFinished = 50
+
+// gameView is a copy of the public state of a game taken by the commands
+// after each change, the web handlers read it instead of the game so they
+// don't race with the commands.
+type gameView struct {
+	ID        string     `json:"id"`
+	GuildID   string     `json:"guild_id"`
+	ChannelID string     `json:"channel_id"`
+	White     viewPlayer `json:"white"`
+	Black     viewPlayer `json:"black"`
+	FEN       string     `json:"fen"`
+	Moves     []string   `json:"moves"`
+	// Turn is "white" or "black"
+	Turn    string     `json:"turn"`
+	Outcome string     `json:"outcome"`
+	Method  string     `json:"method,omitempty"`
+	Over    bool       `json:"over"`
+	Clock   *viewClock `json:"clock,omitempty"`
+	Started time.Time  `json:"started"`
+	Updated time.Time  `json:"updated"`
+	// Version increases with every update of any game
+	Version int `json:"version"`
+
+	// frames are the positions from the start with the move to each one
+	// marked, marks are the ones of the current position
+	frames []chessimage.Frame
+	marks  []chessimage.Mark
+}
+
+type viewPlayer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// viewClock is the time left of each player when the view was taken.
+type viewClock struct {
+	White time.Duration
+	Black time.Duration
+}
+
+func (cl viewClock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		White int64 `json:"white_ms"`
+		Black int64 `json:"black_ms"`
+	}{cl.White.Milliseconds(), cl.Black.Milliseconds()})
+}
+
+// clockAt returns the clock at now, the time of the player to move runs
+// from the view update until the game is over.
+func (v *gameView) clockAt(now time.Time) *viewClock {
+	if v.Clock == nil {
+		return nil
+	}
+	cl := *v.Clock
+	if v.Over {
+		return &cl
+	}
+	left := &cl.White
+	if v.Turn == "black" {
+		left = &cl.Black
+	}
+	if *left -= now.Sub(v.Updated); *left < 0 {
+		*left = 0
+	}
+	return &cl
+}
+
+// live keeps the views of the games in progress and of the last finished
+// ones, and notifies the subscribers of their updates.
+type live struct {
+	views map[string]*gameView
+	// finished are the ids of the finished games, oldest first
+	finished []string
+	subs     map[string]map[chan *gameView]struct{}
+	version  int
+	mu       sync.Mutex
+}
+
+func newLive() *live {
+	return &live{
+		views: map[string]*gameView{},
+		subs:  map[string]map[chan *gameView]struct{}{},
+	}
+}
+
+// update stores v and sends it to the subscribers of the game, unless
+// nothing changed since the last view.
+func (l *live) update(v *gameView) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prev := l.views[v.ID]
+	if prev != nil && prev.FEN == v.FEN && len(prev.Moves) == len(v.Moves) &&
+		prev.Outcome == v.Outcome && prev.Over == v.Over && prev.White == v.White && prev.Black == v.Black {
+		return
+	}
+	l.version++
+	v.Version = l.version
+	l.views[v.ID] = v
+
+	if v.Over && (prev == nil || !prev.Over) {
+		l.finished = append(l.finished, v.ID)
+		if len(l.finished) > maxFinished {
+			l.remove(l.finished[0])
+			l.finished = l.finished[1:]
+		}
+	}
+	for ch := range l.subs[v.ID] {
+		// subscribers only care about the latest view, drop a stale one
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- v
+	}
+}
+
+// drop removes the game and closes its subscriptions.
+func (l *live) drop(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.remove(id)
+}
+
+// remove deletes the view of the game and closes its subscriptions, l.mu
+// must be held.
+func (l *live) remove(id string) {
+	delete(l.views, id)
+	for ch := range l.subs[id] {
+		close(ch)
+	}
+	delete(l.subs, id)
+}
+
+// subscribe returns a channel receiving the views of the game, closed if
+// the game is dropped, and a function to unsubscribe.
+func (l *live) subscribe(id string) (<-chan *gameView, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan *gameView, 1)
+	if l.subs[id] == nil {
+		l.subs[id] = map[chan *gameView]struct{}{}
+	}
+	l.subs[id][ch] = struct{}{}
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if _, ok := l.subs[id][ch]; !ok {
+			return
+		}
+		delete(l.subs[id], ch)
+		if len(l.subs[id]) == 0 {
+			delete(l.subs, id)
+		}
+	}
+}
+
+func (l *live) get(id string) *gameView {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.views[id]
+}
+
+// list returns the games in progress, oldest first, and the finished ones,
+// last finished first.
+func (l *live) list() (active, finished []*gameView) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, v := range l.views {
+		if !v.Over {
+			active = append(active, v)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Started.Before(active[j].Started) })
+	for i := len(l.finished) - 1; i >= 0; i-- {
+		finished = append(finished, l.views[l.finished[i]])
+	}
+	return active, finished
+}
+
+// publish updates the view of g, s fetches the player names and can be nil
+// if they are not needed yet.
+func (c *ChessHandler) publish(g *game, s Session) {
+	white, black := g.whiteID, g.blackID
+	if s != nil {
+		p := c.panel(g, s)
+		white, black = p.White.Name, p.Black.Name
+	}
+
+	v := &gameView{
+		ID:        g.id,
+		GuildID:   g.guildID,
+		ChannelID: g.channelID,
+		White:     viewPlayer{ID: g.whiteID, Name: white},
+		Black:     viewPlayer{ID: g.blackID, Name: black},
+		FEN:       g.Position().String(),
+		Moves:     movesNotation(g),
+		Turn:      "white",
+		Outcome:   g.Outcome().String(),
+		Over:      g.over(),
+		Started:   g.createdAt,
+		Updated:   time.Now().UTC(),
+		frames:    replayFrames(g),
+		marks:     c.boardMarks(g),
+	}
+	if g.Position().Turn() == chess.Black {
+		v.Turn = "black"
+	}
+	if v.Over {
+		v.Method = g.methodString()
+	}
+	if g.clock != nil {
+		turn := g.Position().Turn()
+		v.Clock = &viewClock{
+			White: g.clock.remaining(chess.White, turn, v.Updated),
+			Black: g.clock.remaining(chess.Black, turn, v.Updated),
+		}
+	}
+	c.live.update(v)
+}
@@ -0,0 +1,30 @@
+package discordchess
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLiveEvictsFinished(t *testing.T) {
+	l := newLive()
+	l.update(&gameView{ID: "first", Over: true})
+	ch, unsubscribe := l.subscribe("first")
+	defer unsubscribe()
+
+	for i := 0; i < maxFinished; i++ {
+		l.update(&gameView{ID: fmt.Sprint("game", i), Over: true})
+	}
+	if l.get("first") != nil {
+		t.Error("oldest finished game still kept")
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("evicted game sent a view")
+		}
+	default:
+		t.Error("subscription of the evicted game not closed")
+	}
+	// unsubscribing after the eviction is a no-op
+	unsubscribe()
+}
@@ -0,0 +1,53 @@
+package discordchess
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// logger writes structured log lines as key=value pairs.
+type logger struct {
+	out *log.Logger
+	// kv are the fields added to every line
+	kv []interface{}
+}
+
+// with returns a logger adding the key value pairs to every line.
+func (l *logger) with(kv ...interface{}) *logger {
+	return &logger{
+		out: l.out,
+		kv:  append(append([]interface{}{}, l.kv...), kv...),
+	}
+}
+
+func (l *logger) info(msg string, kv ...interface{}) {
+	l.write("info", msg, kv)
+}
+
+func (l *logger) error(msg string, err error, kv ...interface{}) {
+	l.write("error", msg, append(kv, "err", err))
+}
+
+func (l *logger) write(level, msg string, kv []interface{}) {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "level=%s msg=%s", level, logValue(msg))
+	kv = append(append([]interface{}{}, l.kv...), kv...)
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := fmt.Sprint(kv[i+1])
+		if v == "" {
+			continue
+		}
+		fmt.Fprintf(sb, " %s=%s", kv[i], logValue(v))
+	}
+	l.out.Print(sb.String())
+}
+
+// logValue quotes s if it has spaces or symbols that would break the pairs.
+func logValue(s string) string {
+	if strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
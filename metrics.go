@@ -0,0 +1,159 @@
+package discordchess
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics are exposed in the prometheus text format.
+type metrics struct {
+	gamesStarted  counter
+	gamesFinished counter
+	commands      counter
+	commandErrors counter
+	rateLimited   counter
+	webhooks      counter
+	render        histogram
+	engine        histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		gamesStarted:  counter{values: map[string]float64{}},
+		gamesFinished: counter{values: map[string]float64{}},
+		commands:      counter{values: map[string]float64{}},
+		commandErrors: counter{values: map[string]float64{}},
+		rateLimited:   counter{values: map[string]float64{}},
+		webhooks:      counter{values: map[string]float64{}},
+		render:        newHistogram(),
+		engine:        newHistogram(),
+	}
+}
+
+// labels formats label pairs as `{k="v",...}`.
+func labels(kv ...string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", kv[i], v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// counter is a counter vector keyed by its formatted labels.
+type counter struct {
+	values map[string]float64
+	mu     sync.Mutex
+}
+
+func (c *counter) inc(kv ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[labels(kv...)]++
+}
+
+func (c *counter) write(w io.Writer, name, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %g\n", name, k, c.values[k])
+	}
+}
+
+// latencyBuckets are the histogram upper bounds in seconds.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram is a latency histogram vector keyed by its formatted labels.
+type histogram struct {
+	series map[string]*series
+	mu     sync.Mutex
+}
+
+type series struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram() histogram {
+	return histogram{series: map[string]*series{}}
+}
+
+func (h *histogram) observe(d time.Duration, kv ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := labels(kv...)
+	s, ok := h.series[key]
+	if !ok {
+		s = &series{counts: make([]uint64, len(latencyBuckets))}
+		h.series[key] = s
+	}
+	v := d.Seconds()
+	for i, b := range latencyBuckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		// the le label goes along the series labels
+		inner := strings.TrimSuffix(strings.TrimPrefix(k, "{"), "}")
+		if inner != "" {
+			inner += ","
+		}
+		for i, b := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%g\"} %d\n", name, inner, b, s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, inner, s.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", name, k, s.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", name, k, s.count)
+	}
+}
+
+// WriteMetrics writes the handler metrics in the prometheus text format.
+func (c *ChessHandler) WriteMetrics(w io.Writer) {
+	c.states.mu.Lock()
+	active := len(c.states.games)
+	c.states.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP discordchess_active_games Games in progress.\n# TYPE discordchess_active_games gauge\n")
+	fmt.Fprintf(w, "discordchess_active_games %d\n", active)
+	c.metrics.gamesStarted.write(w, "discordchess_games_started_total", "Games started.")
+	c.metrics.gamesFinished.write(w, "discordchess_games_finished_total", "Games finished by outcome and method.")
+	c.metrics.commands.write(w, "discordchess_commands_total", "Commands processed.")
+	c.metrics.commandErrors.write(w, "discordchess_command_errors_total", "Commands failed by type, user errors are replied to the user.")
+	c.metrics.rateLimited.write(w, "discordchess_rate_limited_total", "Commands refused by the rate limits.")
+	c.metrics.webhooks.write(w, "discordchess_webhook_deliveries_total", "Webhook deliveries by result, retry counts the failed attempts retried.")
+	c.metrics.render.write(w, "discordchess_render_seconds", "Time to render the boards and replays.")
+	c.metrics.engine.write(w, "discordchess_engine_move_seconds", "Time for the engine to find a move.")
+}
@@ -0,0 +1,50 @@
+package discordchess
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	for i, st := range steps(start, moves("f3", "e5", "g4", "Qh4"), start, moves("e5")) {
+		c.HandleMessage(s, st.message(i))
+	}
+
+	buf := &bytes.Buffer{}
+	c.WriteMetrics(buf)
+	out := buf.String()
+	for _, want := range []string{
+		"discordchess_active_games 1\n",
+		"discordchess_games_started_total 2\n",
+		`discordchess_games_finished_total{outcome="0-1",method="Checkmate"} 1` + "\n",
+		`discordchess_commands_total{command="move"} 5` + "\n",
+		`discordchess_command_errors_total{command="move",type="user"} 1` + "\n",
+		`discordchess_render_seconds_bucket{kind="board",le="+Inf"} 6` + "\n",
+		`discordchess_render_seconds_count{kind="gif"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	for _, tt := range []struct {
+		kv   []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"command", "move"}, `{command="move"}`},
+		{[]string{"a", `say "hi"`, "b", `C:\games` + "\n"}, `{a="say \"hi\"",b="C:\\games\n"}`},
+	} {
+		if got := labels(tt.kv...); got != tt.want {
+			t.Errorf("labels(%q) = %s, want %s", tt.kv, got, tt.want)
+		}
+	}
+}
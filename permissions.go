@@ -0,0 +1,86 @@
+package discordchess
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// memberPermissions computes the permission bits of the user with roles in
+// the channel, from the guild roles and the channel overwrites.
+func memberPermissions(g *discordgo.Guild, ch *discordgo.Channel, userID string, roles []string) int64 {
+	if g.OwnerID == userID {
+		return discordgo.PermissionAll
+	}
+
+	var perms int64
+	for _, r := range g.Roles {
+		// the @everyone role has the guild ID
+		if r.ID == g.ID || contains(roles, r.ID) {
+			perms |= r.Permissions
+		}
+	}
+	if perms&discordgo.PermissionAdministrator != 0 {
+		return discordgo.PermissionAll
+	}
+	if ch == nil {
+		return perms
+	}
+
+	// Overwrites apply @everyone first, then the roles and then the member
+	for _, o := range ch.PermissionOverwrites {
+		if o.Type == discordgo.PermissionOverwriteTypeRole && o.ID == g.ID {
+			perms = perms&^o.Deny | o.Allow
+		}
+	}
+	var allow, deny int64
+	for _, o := range ch.PermissionOverwrites {
+		if o.Type == discordgo.PermissionOverwriteTypeRole && contains(roles, o.ID) {
+			allow |= o.Allow
+			deny |= o.Deny
+		}
+	}
+	perms = perms&^deny | allow
+	for _, o := range ch.PermissionOverwrites {
+		if o.Type == discordgo.PermissionOverwriteTypeMember && o.ID == userID {
+			perms = perms&^o.Deny | o.Allow
+		}
+	}
+	return perms
+}
+
+// authorPermissions returns the permission bits of the message author in
+// its channel, zero outside of guilds or if they can't be fetched.
+func authorPermissions(s Session, m *discordgo.MessageCreate, l *logger) int64 {
+	if m.GuildID == "" || m.Member == nil {
+		return 0
+	}
+	g, err := s.Guild(m.GuildID)
+	if err != nil {
+		l.error("failed to fetch guild", err)
+		return 0
+	}
+	ch, err := s.Channel(m.ChannelID)
+	if err != nil {
+		l.error("failed to fetch channel", err)
+		ch = nil
+	}
+	return memberPermissions(g, ch, m.Author.ID, m.Member.Roles)
+}
+
+// isAdmin reports whether the author can manage the guild or has one of the
+// admin roles.
+func isAdmin(r *request) bool {
+	if r.m.Member != nil {
+		for _, mr := range r.m.Member.Roles {
+			if contains(r.cfg.adminRoles, mr) {
+				return true
+			}
+		}
+	}
+	return r.perms()&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0
+}
+
+// isModerator reports whether the author is an admin or can manage the
+// messages of the channel.
+func isModerator(r *request) bool {
+	return isAdmin(r) || r.perms()&discordgo.PermissionManageMessages != 0
+}
@@ -0,0 +1,58 @@
+package discordchess
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMemberPermissions(t *testing.T) {
+	const (
+		send   = discordgo.PermissionSendMessages
+		manage = discordgo.PermissionManageMessages
+	)
+	g := &discordgo.Guild{
+		ID:      "guild",
+		OwnerID: "owner",
+		Roles: []*discordgo.Role{
+			{ID: "guild", Permissions: send},
+			{ID: "admin", Permissions: discordgo.PermissionAdministrator},
+			{ID: "mod", Permissions: manage},
+			{ID: "helper"},
+		},
+	}
+	overwrites := func(o ...*discordgo.PermissionOverwrite) *discordgo.Channel {
+		return &discordgo.Channel{ID: "channel", PermissionOverwrites: o}
+	}
+	role := func(id string, allow, deny int64) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: discordgo.PermissionOverwriteTypeRole, Allow: allow, Deny: deny}
+	}
+	member := func(id string, allow, deny int64) *discordgo.PermissionOverwrite {
+		return &discordgo.PermissionOverwrite{ID: id, Type: discordgo.PermissionOverwriteTypeMember, Allow: allow, Deny: deny}
+	}
+
+	tests := []struct {
+		name  string
+		user  string
+		roles []string
+		ch    *discordgo.Channel
+		want  int64
+	}{
+		{"everyone", "user", nil, nil, send},
+		{"owner", "owner", nil, nil, discordgo.PermissionAll},
+		{"administrator", "user", []string{"admin"}, overwrites(role("guild", 0, send)), discordgo.PermissionAll},
+		{"roles", "user", []string{"mod"}, nil, send | manage},
+		{"everyone overwrite", "user", nil, overwrites(role("guild", 0, send)), 0},
+		{"role overwrite", "user", []string{"helper"}, overwrites(role("helper", manage, 0)), send | manage},
+		{"role allow wins over role deny", "user", []string{"mod", "helper"}, overwrites(role("mod", 0, manage), role("helper", manage, 0)), send | manage},
+		{"member overwrite", "user", []string{"mod"}, overwrites(member("user", 0, manage)), send},
+		{"other member overwrite", "user", []string{"mod"}, overwrites(member("other", 0, manage)), send | manage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := memberPermissions(g, tt.ch, tt.user, tt.roles); got != tt.want {
+				t.Errorf("permissions %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package discordchess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// Elo parameters of the player ratings.
+const (
+	initialRating = 1200
+	ratingK       = 32
+)
+
+// playerStats are the results and the rating of a player.
+type playerStats struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Rating   int       `json:"rating"`
+	Games    int       `json:"games"`
+	Wins     int       `json:"wins"`
+	Losses   int       `json:"losses"`
+	Draws    int       `json:"draws"`
+	LastGame time.Time `json:"last_game"`
+}
+
+// ratingChange is the rating of a player before and after a game.
+type ratingChange struct {
+	PlayerID string `json:"player"`
+	Before   int    `json:"before"`
+	After    int    `json:"after"`
+}
+
+// PlayerStore keeps the players stats, in memory or in a json file.
+type PlayerStore struct {
+	path    string
+	players map[string]*playerStats
+	mu      sync.Mutex
+}
+
+// NewPlayerStore returns a store kept in memory.
+func NewPlayerStore() *PlayerStore {
+	return &PlayerStore{players: map[string]*playerStats{}}
+}
+
+// LoadPlayerStore loads the store from the json file at path, the file is
+// created after the first game if it doesn't exist.
+func LoadPlayerStore(path string) (*PlayerStore, error) {
+	ps := NewPlayerStore()
+	ps.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ps, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ps.players); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ps, nil
+}
+
+// get returns a copy of the player stats.
+func (ps *PlayerStore) get(id string) (playerStats, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	p, ok := ps.players[id]
+	if !ok {
+		return playerStats{}, false
+	}
+	return *p, true
+}
+
+// record adds the outcome of a game to both players and saves the store,
+// it returns the rating changes of white and black.
+func (ps *PlayerStore) record(white, black viewPlayer, o chess.Outcome, at time.Time) ([]ratingChange, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	w, b := ps.player(white), ps.player(black)
+	score := 0.5
+	switch o {
+	case chess.WhiteWon:
+		score = 1
+		w.Wins++
+		b.Losses++
+	case chess.BlackWon:
+		score = 0
+		w.Losses++
+		b.Wins++
+	default:
+		w.Draws++
+		b.Draws++
+	}
+
+	changes := []ratingChange{
+		{PlayerID: w.ID, Before: w.Rating},
+		{PlayerID: b.ID, Before: b.Rating},
+	}
+	expected := 1 / (1 + math.Pow(10, float64(b.Rating-w.Rating)/400))
+	delta := int(math.Round(ratingK * (score - expected)))
+	w.Rating += delta
+	b.Rating -= delta
+	changes[0].After, changes[1].After = w.Rating, b.Rating
+
+	for _, p := range []*playerStats{w, b} {
+		p.Games++
+		p.LastGame = at
+	}
+	return changes, ps.save()
+}
+
+// player returns the stats of p, created with the initial rating, and
+// keeps its latest name.
+func (ps *PlayerStore) player(p viewPlayer) *playerStats {
+	s, ok := ps.players[p.ID]
+	if !ok {
+		s = &playerStats{ID: p.ID, Rating: initialRating}
+		ps.players[p.ID] = s
+	}
+	if p.Name != "" && p.Name != p.ID {
+		s.Name = p.Name
+	}
+	return s
+}
+
+// save writes the store to its file if any.
+func (ps *PlayerStore) save() error {
+	if ps.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ps.players, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(ps.path, data)
+}
+
+// WithPlayerStore sets the store of the players ratings and results.
+func WithPlayerStore(ps *PlayerStore) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.players = ps
+	}
+}
+
+// recordResult rates the players of a finished game, aborted and
+// adjudicated games, games against oneself and against the bot botID are
+// not rated.
+func (c *ChessHandler) recordResult(g *game, botID string) []ratingChange {
+	switch {
+	case g.Outcome() == chess.NoOutcome, g.whiteID == g.blackID,
+		g.whiteID == botID, g.blackID == botID,
+		g.method == methodAborted, g.method == methodAdjudicated:
+		return nil
+	}
+	v := c.live.get(g.id)
+	white, black := viewPlayer{ID: g.whiteID}, viewPlayer{ID: g.blackID}
+	if v != nil {
+		white, black = v.White, v.Black
+	}
+	changes, err := c.players.record(white, black, g.Outcome(), time.Now().UTC())
+	if err != nil {
+		c.log.error("failed to save players", err, "game", g.id)
+	}
+	return changes
+}
@@ -0,0 +1,36 @@
+package discordchess
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestRecordResult(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		white, black string
+		end          func(g *game)
+		rated        bool
+	}{
+		{"resigned", "white", "black", func(g *game) { g.Resign(chess.Black) }, true},
+		{"against the bot", "white", "bot", func(g *game) { g.Resign(chess.Black) }, false},
+		{"bot as white", "bot", "black", func(g *game) { g.Resign(chess.White) }, false},
+		{"adjudicated", "white", "black", func(g *game) { g.adjudicate(chess.WhiteWon, "mod") }, false},
+		{"aborted", "white", "black", func(g *game) { g.abort("mod") }, false},
+	}
+	for _, tt := range tests {
+		c.players = NewPlayerStore()
+		g := newGame("guild", testChannel, tt.white, tt.black, nil, timeControl{})
+		tt.end(g)
+		changes := c.recordResult(g, "bot")
+		_, ok := c.players.get(tt.white)
+		if rated := len(changes) != 0; rated != tt.rated || ok != tt.rated {
+			t.Errorf("%s: rated %v with changes %+v, want %v", tt.name, ok, changes, tt.rated)
+		}
+	}
+}
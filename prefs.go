@@ -0,0 +1,89 @@
+package discordchess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// userPrefs are the preferences of a user.
+type userPrefs struct {
+	Theme string `json:"theme,omitempty"`
+}
+
+// PrefStore keeps the users preferences, in memory or in a json file.
+type PrefStore struct {
+	path  string
+	users map[string]*userPrefs
+	mu    sync.Mutex
+}
+
+// NewPrefStore returns a store kept in memory.
+func NewPrefStore() *PrefStore {
+	return &PrefStore{users: map[string]*userPrefs{}}
+}
+
+// LoadPrefStore loads the store from the json file at path, the file is
+// created on the first change if it doesn't exist.
+func LoadPrefStore(path string) (*PrefStore, error) {
+	ps := NewPrefStore()
+	ps.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ps, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ps.users); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ps, nil
+}
+
+// WithPrefStore sets the store of the users preferences.
+func WithPrefStore(ps *PrefStore) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.prefs = ps
+	}
+}
+
+func (ps *PrefStore) theme(userID string) string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if u, ok := ps.users[userID]; ok {
+		return u.Theme
+	}
+	return ""
+}
+
+// setTheme sets the theme of the user and saves the store.
+func (ps *PrefStore) setTheme(userID, theme string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	u, ok := ps.users[userID]
+	if !ok {
+		u = &userPrefs{}
+		ps.users[userID] = u
+	}
+	u.Theme = theme
+	return ps.save()
+}
+
+// save writes the store to its file if any.
+func (ps *PrefStore) save() error {
+	if ps.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(ps.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(ps.path, data)
+}
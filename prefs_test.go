@@ -0,0 +1,43 @@
+package discordchess
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrefStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prefs.json")
+	ps, err := LoadPrefStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New("!", "", nil, WithPrefStore(ps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	c.HandleMessage(s, step{author: "user", content: "!theme wood"}.message(0))
+
+	// a restarted bot keeps the theme
+	ps, err = LoadPrefStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = New("!", "", nil, WithPrefStore(ps)); err != nil {
+		t.Fatal(err)
+	}
+	s.reset()
+	c.HandleMessage(s, step{author: "user", content: "!theme"}.message(1))
+	want := []sent{{"message", testChannel, "Your theme: `wood`"}}
+	if got := s.reset(); !containsSends(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPrefStore(path); err == nil {
+		t.Error("loaded an invalid prefs file")
+	}
+}
@@ -0,0 +1,152 @@
+package discordchess
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket holding up to Burst tokens refilled at Rate
+// tokens per second, a zero Rate disables it.
+type RateLimit struct {
+	Burst float64
+	Rate  float64
+}
+
+// RateLimits limits the commands of each user and of each channel, a
+// command takes its cost from both buckets.
+type RateLimits struct {
+	User    RateLimit
+	Channel RateLimit
+	// Costs overrides the cost of the commands by name, they cost one
+	// token by default and more if they upload or render a replay.
+	Costs map[string]float64
+}
+
+// WithRateLimits limits the commands, admins are exempt.
+func WithRateLimits(l RateLimits) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.limiter = newLimiter(l)
+	}
+}
+
+// maxBuckets is the number of buckets kept before dropping the full ones.
+const maxBuckets = 4096
+
+// limiter keeps the buckets of the users and channels.
+type limiter struct {
+	limits  RateLimits
+	buckets map[string]*bucket
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+func newLimiter(l RateLimits) *limiter {
+	return &limiter{
+		limits:  l,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	// warned is set once the user was told to slow down, until the
+	// bucket has tokens again
+	warned bool
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.limit.Burst, b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// cost returns the tokens taken by cmd.
+func (l *limiter) cost(cmd *command) float64 {
+	if c, ok := l.limits.Costs[cmd.name]; ok {
+		return c
+	}
+	if cmd.cost > 0 {
+		return cmd.cost
+	}
+	return 1
+}
+
+// take takes cost tokens from the buckets of the user and the channel if
+// both have them, otherwise it returns the wait until they do and whether
+// the wait was already returned for those buckets. Only the user bucket is
+// used if channelID is empty.
+func (l *limiter) take(userID, channelID string, cost float64) (wait time.Duration, warned bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) > maxBuckets {
+		l.prune(now)
+	}
+
+	buckets := []*bucket{}
+	if l.limits.User.Rate > 0 {
+		buckets = append(buckets, l.bucket("user:"+userID, l.limits.User, now))
+	}
+	if l.limits.Channel.Rate > 0 && channelID != "" {
+		buckets = append(buckets, l.bucket("channel:"+channelID, l.limits.Channel, now))
+	}
+
+	short := []*bucket{}
+	for _, b := range buckets {
+		// a cost over the burst would never fit
+		need := math.Min(cost, b.limit.Burst)
+		if b.tokens >= need {
+			continue
+		}
+		short = append(short, b)
+		secs := (need - b.tokens) / b.limit.Rate
+		if w := time.Duration(secs * float64(time.Second)); w > wait {
+			wait = w
+		}
+	}
+	if len(short) > 0 {
+		warned = true
+		for _, b := range short {
+			if !b.warned {
+				warned = false
+			}
+			b.warned = true
+		}
+		return wait, warned
+	}
+
+	for _, b := range buckets {
+		b.tokens = math.Max(0, b.tokens-cost)
+		b.warned = false
+	}
+	return 0, false
+}
+
+// bucket returns the bucket at key refilled to now, new buckets are full.
+func (l *limiter) bucket(key string, limit RateLimit, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limit: limit, tokens: limit.Burst, last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+	return b
+}
+
+// prune drops the buckets that are full, they are the same as new ones.
+func (l *limiter) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if b.refill(now); b.tokens >= b.limit.Burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// cooldown formats the wait rounded up to the second.
+func cooldown(wait time.Duration) time.Duration {
+	return time.Duration(math.Ceil(wait.Seconds())) * time.Second
+}
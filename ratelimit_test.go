@@ -0,0 +1,121 @@
+package discordchess
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(RateLimits{
+		User:    RateLimit{Burst: 3, Rate: 1},
+		Channel: RateLimit{Burst: 5, Rate: 0.5},
+	})
+	l.now = func() time.Time { return now }
+
+	type take struct {
+		user   string
+		cost   float64
+		wait   time.Duration
+		warned bool
+	}
+	check := func(takes ...take) {
+		t.Helper()
+		for i, tk := range takes {
+			wait, warned := l.take(tk.user, "channel", tk.cost)
+			if wait != tk.wait || warned != tk.warned {
+				t.Errorf("take %d by %s = %v, %v, want %v, %v", i, tk.user, wait, warned, tk.wait, tk.warned)
+			}
+		}
+	}
+
+	check(
+		take{user: "a", cost: 2},
+		take{user: "a", cost: 2, wait: time.Second},
+		take{user: "a", cost: 1, warned: false},
+		take{user: "a", cost: 1, wait: time.Second, warned: false},
+		// only the first wait is new
+		take{user: "a", cost: 1, wait: time.Second, warned: true},
+		// the channel is shared, it has 2 tokens left
+		take{user: "b", cost: 3, wait: 2 * time.Second},
+		take{user: "b", cost: 1},
+	)
+
+	now = now.Add(8 * time.Second)
+	// the cost is capped to the burst
+	check(take{user: "a", cost: 10})
+	if _, warned := l.take("a", "channel", 1); warned {
+		t.Error("warned after the bucket refilled")
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	c, err := New("!", "", nil, WithRateLimits(RateLimits{
+		User:    RateLimit{Burst: 4, Rate: 1},
+		Channel: RateLimit{Burst: 6, Rate: 1},
+		Costs:   map[string]float64{"theme": 2, "help": 4},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	c.limiter.now = func() time.Time { return now }
+	s := newFakeSession("bot")
+
+	send := func(st step) []sent {
+		c.HandleMessage(s, st.message(0))
+		return s.reset()
+	}
+	theme := step{author: "user", content: "!theme"}
+	for i := 0; i < 2; i++ {
+		if got := send(theme); !containsSends(got, []sent{{"message", testChannel, "Your theme"}}) {
+			t.Fatalf("theme %d sent %v", i, got)
+		}
+	}
+	want := []sent{{"reaction", testChannel, "❌"}, {"reply", testChannel, "Slow down, try again in 2s."}}
+	if got := send(theme); !containsSends(got, want) {
+		t.Errorf("over the limit sent %v, want %v", got, want)
+	}
+	if got := send(theme); len(got) != 0 {
+		t.Errorf("second time over the limit sent %v, want nothing", got)
+	}
+
+	now = now.Add(2 * time.Second)
+	if got := send(theme); !containsSends(got, []sent{{"message", testChannel, "Your theme"}}) {
+		t.Errorf("after the cooldown sent %v", got)
+	}
+	if got := send(step{author: "user", content: "!help"}); !containsSends(got, []sent{{"reply", testChannel, "Slow down"}}) {
+		t.Errorf("help with its configured cost sent %v", got)
+	}
+
+	admin := step{author: "admin", content: "!theme", roles: []string{"boss"}}
+	for i := 0; i < 5; i++ {
+		if got := send(admin); !containsSends(got, []sent{{"message", testChannel, "Your theme"}}) {
+			t.Fatalf("admin theme %d sent %v", i, got)
+		}
+	}
+
+	// typos are answered until the user runs out of tokens
+	typo := step{author: "typist", content: "!them"}
+	for i := 0; i < 4; i++ {
+		if got := send(typo); !containsSends(got, []sent{{"reply", testChannel, "Unknown command `!them`"}}) {
+			t.Fatalf("typo %d sent %v", i, got)
+		}
+	}
+	if got := send(typo); len(got) != 0 {
+		t.Errorf("typo over the limit sent %v, want nothing", got)
+	}
+
+	// neither the admin nor the typos used the channel tokens
+	if got := send(step{author: "other", content: "!theme"}); !containsSends(got, []sent{{"message", testChannel, "Your theme"}}) {
+		t.Errorf("theme after the admin sent %v", got)
+	}
+
+	// the admin check of a typo logs when the guild can't be fetched
+	m := step{author: "stray", content: "!them"}.message(0)
+	m.GuildID = "gone"
+	c.HandleMessage(s, m)
+	if got := s.reset(); !containsSends(got, []sent{{"reply", testChannel, "Unknown command `!them`"}}) {
+		t.Errorf("typo from an unknown guild sent %v", got)
+	}
+}
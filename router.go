@@ -0,0 +1,448 @@
+package discordchess
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// command is a chat command registered in the router.
+type command struct {
+	name    string
+	aliases []string
+	args    []arg
+	perm    permission
+	// game requires a game in progress in the channel
+	game bool
+	// room restricts the command to the channels matching the rooms regexp
+	room bool
+	// hidden commands are not listed in the help
+	hidden bool
+	// cost is the number of rate limit tokens taken, one if zero
+	cost float64
+	// help is the one line description and details the extra text shown
+	// in the command help
+	help    string
+	details string
+	run     func(c *ChessHandler, r *request) error
+}
+
+// arg describes a command argument.
+type arg struct {
+	name string
+	// choices are the valid values if not empty
+	choices  []string
+	mention  bool
+	optional bool
+	// variadic takes the rest of the arguments, it must be the last one
+	variadic bool
+}
+
+func (a arg) usage() string {
+	s := "<" + a.name + ">"
+	switch {
+	case a.optional && len(a.choices) == 0:
+		s = a.name
+	case a.mention:
+		s = "@" + a.name
+	case len(a.choices) > 0:
+		s = strings.Join(a.choices, "|")
+	}
+	if a.variadic {
+		s += "..."
+	}
+	if a.optional {
+		s = "[" + s + "]"
+	}
+	return s
+}
+
+func (a arg) valid(v string) bool {
+	if a.mention {
+		return strings.HasPrefix(v, "<@") && strings.HasSuffix(v, ">")
+	}
+	if len(a.choices) == 0 {
+		return true
+	}
+	for _, c := range a.choices {
+		if strings.EqualFold(c, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// permission is the requirement to run a command.
+type permission int
+
+const (
+	permAnyone permission = iota
+	// permPlayer is either player of the game in the channel
+	permPlayer
+	// permTurn is the player to move
+	permTurn
+	// permModerator is an admin or a member managing the channel messages
+	permModerator
+	// permAdmin is a member managing the guild or with one of the admin
+	// roles
+	permAdmin
+)
+
+func (p permission) String() string {
+	switch p {
+	case permPlayer:
+		return "Only the players of the game."
+	case permTurn:
+		return "Only the player to move."
+	case permModerator:
+		return "Only moderators."
+	case permAdmin:
+		return "Only admins."
+	}
+	return ""
+}
+
+// request is a command invocation.
+type request struct {
+	s    Session
+	m    *discordgo.MessageCreate
+	cmd  *command
+	args []string
+	// rest is the message content after the command name
+	rest string
+	// g is the game in the channel if the command requires one
+	g *game
+	// cfg are the settings of the guild
+	cfg settings
+
+	// log adds the request fields to the lines
+	log *logger
+
+	// permissions of the author in the channel, fetched on first use
+	permissions     int64
+	permissionsOnce sync.Once
+}
+
+// perms returns the author permission bits in the channel.
+func (r *request) perms() int64 {
+	r.permissionsOnce.Do(func() {
+		r.permissions = authorPermissions(r.s, r.m, r.log)
+	})
+	return r.permissions
+}
+
+// react adds the success reaction to the message.
+func (r *request) react() error {
+	return r.s.MessageReactionAdd(r.m.ChannelID, r.m.ID, "✅")
+}
+
+// reply sends content as a reply to the message.
+func (r *request) reply(content string) error {
+	_, err := r.s.ChannelMessageSendReply(
+		r.m.ChannelID,
+		content,
+		&discordgo.MessageReference{
+			ChannelID: r.m.ChannelID,
+			MessageID: r.m.ID,
+		},
+	)
+	return err
+}
+
+// router resolves commands by name or alias.
+type router struct {
+	commands []*command
+	names    map[string]*command
+}
+
+func newRouter(cmds ...*command) *router {
+	rt := &router{names: map[string]*command{}}
+	for _, cmd := range cmds {
+		rt.add(cmd)
+	}
+	return rt
+}
+
+func (rt *router) add(cmd *command) {
+	rt.commands = append(rt.commands, cmd)
+	rt.names[cmd.name] = cmd
+	for _, a := range cmd.aliases {
+		rt.names[a] = cmd
+	}
+}
+
+func (rt *router) lookup(name string) *command {
+	return rt.names[strings.ToLower(name)]
+}
+
+// suggest returns the visible command names closest to name, one edit away
+// for short names and two otherwise.
+func (rt *router) suggest(name string) []string {
+	name = strings.ToLower(name)
+	best, res := 2, []string{}
+	if len(name) > 4 {
+		best = 3
+	}
+	for n, cmd := range rt.names {
+		if cmd.hidden {
+			continue
+		}
+		d := editDistance(name, n)
+		switch {
+		case d < best:
+			best, res = d, []string{cmd.name}
+		case d == best && !contains(res, cmd.name):
+			res = append(res, cmd.name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// dispatch checks the command requirements and runs it.
+func (c *ChessHandler) dispatch(s Session, m *discordgo.MessageCreate, cfg settings, content string) (err error) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	r := &request{
+		s:    s,
+		m:    m,
+		args: fields[1:],
+		rest: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(content), fields[0])),
+		cfg:  cfg,
+		log: c.log.with(
+			"guild", m.GuildID,
+			"channel", m.ChannelID,
+			"user", m.Author.ID,
+		),
+	}
+	cmd := c.commands.lookup(fields[0])
+	if cmd == nil {
+		// the prefix might be shared with other bots, only answer typos
+		if sug := c.commands.suggest(fields[0]); len(sug) > 0 {
+			// the replies cost the user as a command, over the limit the
+			// typos are ignored
+			if c.limiter != nil && !isAdmin(r) {
+				if wait, _ := c.limiter.take(m.Author.ID, "", 1); wait > 0 {
+					c.metrics.rateLimited.inc("command", "unknown")
+					return nil
+				}
+			}
+			return GameError(fmt.Sprintf("Unknown command `%s%s`, did you mean `%s%s`?", cfg.prefix, fields[0], cfg.prefix, strings.Join(sug, "`, `"+cfg.prefix)))
+		}
+		return nil
+	}
+
+	r.cmd = cmd
+	r.log = r.log.with("cmd", cmd.name)
+	start := time.Now()
+	defer func() { c.logCommand(r, err, time.Since(start)) }()
+
+	// admins don't use the tokens of the channel
+	if c.limiter != nil && !isAdmin(r) {
+		wait, warned := c.limiter.take(m.Author.ID, m.ChannelID, c.limiter.cost(cmd))
+		if wait > 0 {
+			c.metrics.rateLimited.inc("command", cmd.name)
+			// only the first command over the limit is answered
+			if warned {
+				return nil
+			}
+			return GameError(fmt.Sprintf("Slow down, try again in %s.", cooldown(wait)))
+		}
+	}
+
+	if !c.validArgs(cmd, r.args) {
+		return GameError(fmt.Sprintf("Usage: `%s`", usage(cfg.prefix, cmd)))
+	}
+
+	if cmd.room {
+		channel, err := s.Channel(m.ChannelID)
+		if err != nil {
+			return err
+		}
+		if !cfg.rooms.MatchString(channel.Name) {
+			return GameError("wrong room")
+		}
+	}
+
+	if cmd.game || cmd.perm == permPlayer || cmd.perm == permTurn {
+		if r.g = c.states.game(m.ChannelID); r.g == nil {
+			return ErrNoGame
+		}
+		r.g.lock()
+		defer r.g.unlock()
+		// the game might have ended while waiting for it
+		if c.states.game(m.ChannelID) != r.g {
+			return ErrNoGame
+		}
+		// the player to move can't hold the game past its time
+		if (m.Author.ID == r.g.whiteID || m.Author.ID == r.g.blackID) && r.g.flagged() {
+			c.audit(r.g, r.g.turn(), auditTimeout, "")
+			return c.checkOutcome(r.g, s, m.ChannelID)
+		}
+	}
+	if !c.allowed(cmd.perm, r) {
+		return GameError("")
+	}
+	return cmd.run(c, r)
+}
+
+// logCommand logs the command with its game and latency, errors shown to the
+// user are not logged as errors.
+func (c *ChessHandler) logCommand(r *request, err error, latency time.Duration) {
+	g := r.g
+	if g == nil {
+		// the game might have been started by the command
+		g = c.states.game(r.m.ChannelID)
+	}
+	gameID := ""
+	if g != nil {
+		gameID = g.id
+	}
+
+	c.metrics.commands.inc("command", r.cmd.name)
+	switch err.(type) {
+	case nil:
+	case GameError:
+		c.metrics.commandErrors.inc("command", r.cmd.name, "type", "user")
+	default:
+		c.metrics.commandErrors.inc("command", r.cmd.name, "type", "internal")
+	}
+
+	if _, ok := err.(GameError); err != nil && !ok {
+		r.log.error("command failed", err, "game", gameID, "latency", latency)
+		return
+	}
+	if err != nil {
+		r.log.info("command rejected", "game", gameID, "latency", latency, "reason", err.Error())
+		return
+	}
+	r.log.info("command", "game", gameID, "latency", latency)
+}
+
+func (c *ChessHandler) validArgs(cmd *command, args []string) bool {
+	for i, a := range cmd.args {
+		if i >= len(args) {
+			return a.optional
+		}
+		if a.variadic {
+			for _, v := range args[i:] {
+				if !a.valid(v) {
+					return false
+				}
+			}
+			return true
+		}
+		if !a.valid(args[i]) {
+			return false
+		}
+	}
+	return len(args) <= len(cmd.args)
+}
+
+func (c *ChessHandler) allowed(p permission, r *request) bool {
+	switch p {
+	case permPlayer:
+		return r.m.Author.ID == r.g.whiteID || r.m.Author.ID == r.g.blackID
+	case permTurn:
+		return r.m.Author.ID == r.g.turn()
+	case permModerator:
+		return isModerator(r)
+	case permAdmin:
+		return isAdmin(r)
+	}
+	return true
+}
+
+// usage returns the command with its arguments i.e: "!move <move>".
+func usage(prefix string, cmd *command) string {
+	parts := []string{prefix + cmd.name}
+	for _, a := range cmd.args {
+		parts = append(parts, a.usage())
+	}
+	return strings.Join(parts, " ")
+}
+
+// help lists the visible commands.
+func (c *ChessHandler) help(prefix string) string {
+	sb := &strings.Builder{}
+	sb.WriteString("Help:\n")
+	for _, cmd := range c.commands.commands {
+		if cmd.hidden {
+			continue
+		}
+		fmt.Fprintf(sb, "  `%s` - %s\n", usage(prefix, cmd), cmd.help)
+	}
+	return sb.String()
+}
+
+// commandHelp describes a command with its aliases and requirements.
+func commandHelp(prefix string, cmd *command) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "`%s` - %s\n", usage(prefix, cmd), cmd.help)
+	if cmd.details != "" {
+		fmt.Fprintln(sb, cmd.details)
+	}
+	if len(cmd.aliases) > 0 {
+		fmt.Fprintf(sb, "Aliases: `%s%s`\n", prefix, strings.Join(cmd.aliases, "`, `"+prefix))
+	}
+	if p := cmd.perm.String(); p != "" {
+		fmt.Fprintln(sb, p)
+	}
+	if cmd.room {
+		fmt.Fprintln(sb, "Only in the chess rooms.")
+	}
+	return sb.String()
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent runes to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func min(v ...int) int {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
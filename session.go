@@ -0,0 +1,38 @@
+package discordchess
+
+import (
+	"image"
+	"io"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Session is the part of the discord session used by the handler.
+type Session interface {
+	ChannelMessageSend(channelID, content string) (*discordgo.Message, error)
+	ChannelMessageSendReply(channelID, content string, reference *discordgo.MessageReference) (*discordgo.Message, error)
+	ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed) (*discordgo.Message, error)
+	ChannelFileSend(channelID, name string, r io.Reader) (*discordgo.Message, error)
+	MessageReactionAdd(channelID, messageID, emojiID string) error
+	User(userID string) (*discordgo.User, error)
+	UserAvatarDecode(u *discordgo.User) (image.Image, error)
+	Channel(channelID string) (*discordgo.Channel, error)
+	Guild(guildID string) (*discordgo.Guild, error)
+	// UserChannelCreate returns the direct message channel with the user.
+	UserChannelCreate(recipientID string) (*discordgo.Channel, error)
+	// BotID returns the user ID of the bot.
+	BotID() string
+}
+
+// DiscordSession adapts a discordgo session to Session.
+func DiscordSession(s *discordgo.Session) Session {
+	return discordSession{s}
+}
+
+type discordSession struct {
+	*discordgo.Session
+}
+
+func (s discordSession) BotID() string {
+	return s.State.User.ID
+}
@@ -0,0 +1,155 @@
+package discordchess
+
+import (
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/bwmarrin/discordgo"
+	"github.com/notnil/chess"
+)
+
+// sent is a message, file or reaction recorded by the fake session.
+type sent struct {
+	kind      string // "message", "reply", "embed", "file" or "reaction"
+	channelID string
+	// content is the message text, the embed description, the file name or
+	// the reaction emoji.
+	content string
+}
+
+// fakeSession records everything the handler sends.
+type fakeSession struct {
+	botID    string
+	guild    *discordgo.Guild
+	channels map[string]*discordgo.Channel
+	// dmErr fails the direct messages, as when users turn them off
+	dmErr error
+
+	mu     sync.Mutex
+	sent   []sent
+	embeds []*discordgo.MessageEmbed
+}
+
+func newFakeSession(botID string) *fakeSession {
+	return &fakeSession{
+		botID: botID,
+		guild: &discordgo.Guild{
+			ID:      "guild",
+			OwnerID: "owner",
+			Roles: []*discordgo.Role{
+				{ID: "guild", Permissions: discordgo.PermissionSendMessages},
+				{ID: "boss", Permissions: discordgo.PermissionAdministrator},
+				{ID: "manager", Permissions: discordgo.PermissionManageServer},
+				{ID: "helper"},
+			},
+		},
+		channels: map[string]*discordgo.Channel{
+			testChannel: {
+				ID:   testChannel,
+				Name: "chess",
+				// helpers moderate the chess channel, except muted
+				PermissionOverwrites: []*discordgo.PermissionOverwrite{
+					{ID: "helper", Type: discordgo.PermissionOverwriteTypeRole, Allow: discordgo.PermissionManageMessages},
+					{ID: "muted", Type: discordgo.PermissionOverwriteTypeMember, Deny: discordgo.PermissionManageMessages},
+				},
+			},
+		},
+	}
+}
+
+func (f *fakeSession) record(kind, channelID, content string) *discordgo.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, sent{kind, channelID, content})
+	return &discordgo.Message{ChannelID: channelID, Content: content}
+}
+
+func (f *fakeSession) ChannelMessageSend(channelID, content string) (*discordgo.Message, error) {
+	return f.record("message", channelID, content), nil
+}
+
+func (f *fakeSession) ChannelMessageSendReply(channelID, content string, _ *discordgo.MessageReference) (*discordgo.Message, error) {
+	return f.record("reply", channelID, content), nil
+}
+
+func (f *fakeSession) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+	f.mu.Lock()
+	f.embeds = append(f.embeds, embed)
+	f.mu.Unlock()
+	return f.record("embed", channelID, embed.Description), nil
+}
+
+func (f *fakeSession) ChannelFileSend(channelID, name string, r io.Reader) (*discordgo.Message, error) {
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return nil, err
+	}
+	return f.record("file", channelID, name), nil
+}
+
+func (f *fakeSession) MessageReactionAdd(channelID, _, emojiID string) error {
+	f.record("reaction", channelID, emojiID)
+	return nil
+}
+
+func (f *fakeSession) User(userID string) (*discordgo.User, error) {
+	return &discordgo.User{ID: userID, Username: userID}, nil
+}
+
+func (f *fakeSession) UserAvatarDecode(*discordgo.User) (image.Image, error) {
+	return nil, errors.New("no avatar")
+}
+
+func (f *fakeSession) Channel(channelID string) (*discordgo.Channel, error) {
+	if ch, ok := f.channels[channelID]; ok {
+		return ch, nil
+	}
+	return &discordgo.Channel{ID: channelID, Name: "chess"}, nil
+}
+
+func (f *fakeSession) Guild(guildID string) (*discordgo.Guild, error) {
+	if guildID != f.guild.ID {
+		return nil, errors.New("unknown guild")
+	}
+	return f.guild, nil
+}
+
+// UserChannelCreate returns the channel "dm:<user id>".
+func (f *fakeSession) UserChannelCreate(recipientID string) (*discordgo.Channel, error) {
+	if f.dmErr != nil {
+		return nil, f.dmErr
+	}
+	return &discordgo.Channel{ID: "dm:" + recipientID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (f *fakeSession) BotID() string {
+	return f.botID
+}
+
+// reset returns the recorded sends and clears them.
+func (f *fakeSession) reset() []sent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := f.sent
+	f.sent = nil
+	return res
+}
+
+// firstMoveEngine plays the first legal move.
+type firstMoveEngine struct{}
+
+func (firstMoveEngine) Search(pos *chess.Position, _ time.Duration) (*chess.Move, chessimage.Eval, error) {
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		return nil, chessimage.Eval{}, errors.New("no legal moves")
+	}
+	return moves[0], chessimage.Eval{}, nil
+}
+
+func (firstMoveEngine) Close() error { return nil }
@@ -0,0 +1,226 @@
+package discordchess
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// WithGamesFile sets the file where Shutdown saves the games in progress
+// and LoadGames restores them from.
+func WithGamesFile(path string) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.gamesFile = path
+	}
+}
+
+// begin registers an in-flight command, it returns false once shutting down.
+func (c *ChessHandler) begin() bool {
+	c.closingMu.RLock()
+	defer c.closingMu.RUnlock()
+
+	if c.closing {
+		return false
+	}
+	c.inflight.Add(1)
+	return true
+}
+
+// Shutdown stops accepting commands, waits for the running ones including
+// bot moves, saves the games in progress if there is a games file, tells
+// their channels and closes their engines, then waits for the webhook
+// deliveries. If ctx is done first the games still used by a command are
+// neither saved nor closed, their channels are told the game is lost.
+func (c *ChessHandler) Shutdown(ctx context.Context, s Session) error {
+	c.closingMu.Lock()
+	c.closing = true
+	c.closingMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for running commands: %w", ctx.Err())
+	}
+
+	c.states.mu.Lock()
+	defer c.states.mu.Unlock()
+
+	// the free games stay locked, nothing else runs once closing
+	idle := map[string]*game{}
+	for channelID, g := range c.states.games {
+		if g.tryLock() {
+			idle[channelID] = g
+		}
+	}
+
+	msg := "Bot restarting, your game is saved, continue it once I'm back."
+	if c.gamesFile == "" {
+		msg = "Bot restarting, sorry, your game can't be saved."
+	} else if serr := c.saveGames(idle); serr != nil {
+		c.log.error("failed to save games", serr)
+		msg = "Bot restarting, sorry, your game couldn't be saved."
+		if err == nil {
+			err = serr
+		}
+	}
+	for channelID, g := range c.states.games {
+		gmsg := msg
+		if idle[channelID] == nil {
+			c.log.error("game still in use at shutdown", err, "game", g.id)
+			gmsg = "Bot restarting, sorry, your game couldn't be saved."
+		} else {
+			g.Close()
+		}
+		if _, serr := s.ChannelMessageSend(channelID, gmsg); serr != nil {
+			c.log.error("failed to notify game", serr, "game", g.id)
+		}
+		delete(c.states.games, channelID)
+	}
+	if werr := c.webhooks.close(ctx); werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}
+
+// savedGame is a game in progress in the games file.
+type savedGame struct {
+	ID          string    `json:"id"`
+	GuildID     string    `json:"guild"`
+	ChannelID   string    `json:"channel"`
+	WhiteID     string    `json:"white"`
+	BlackID     string    `json:"black"`
+	CreatedAt   time.Time `json:"created_at"`
+	Bot         bool      `json:"bot,omitempty"`
+	BotLevel    *int      `json:"bot_level,omitempty"`
+	EvalBar     bool      `json:"eval_bar,omitempty"`
+	TimeControl string    `json:"time_control,omitempty"`
+	// WhiteLeft and BlackLeft are the clocks of timed games
+	WhiteLeft time.Duration `json:"white_left,omitempty"`
+	BlackLeft time.Duration `json:"black_left,omitempty"`
+	// Moves in uci notation
+	Moves []string `json:"moves"`
+}
+
+// saveGames writes the games to the games file, they must be locked.
+func (c *ChessHandler) saveGames(games map[string]*game) error {
+	saved := []savedGame{}
+	now := time.Now().UTC()
+	for _, g := range games {
+		sg := savedGame{
+			ID:        g.id,
+			GuildID:   g.guildID,
+			ChannelID: g.channelID,
+			WhiteID:   g.whiteID,
+			BlackID:   g.blackID,
+			CreatedAt: g.createdAt,
+			Bot:       g.eng != nil,
+			EvalBar:   g.evalBar,
+		}
+		if g.eng != nil {
+			lvl := g.botLevel
+			sg.BotLevel = &lvl
+		}
+		if g.clock != nil {
+			turn := g.Position().Turn()
+			sg.TimeControl = g.clock.tc.String()
+			sg.WhiteLeft = g.clock.remaining(chess.White, turn, now)
+			sg.BlackLeft = g.clock.remaining(chess.Black, turn, now)
+		}
+		for _, m := range g.Moves() {
+			sg.Moves = append(sg.Moves, chess.UCINotation{}.Encode(nil, m))
+		}
+		saved = append(saved, sg)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.gamesFile, data)
+}
+
+// LoadGames restores the games saved by Shutdown and removes the games
+// file, it returns the number of games restored.
+func (c *ChessHandler) LoadGames() (int, error) {
+	if c.gamesFile == "" {
+		return 0, nil
+	}
+	data, err := ioutil.ReadFile(c.gamesFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	saved := []savedGame{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, fmt.Errorf("%s: %w", c.gamesFile, err)
+	}
+
+	n := 0
+	for _, sg := range saved {
+		g, err := c.restoreGame(sg)
+		if err != nil {
+			c.log.error("failed to restore game", err, "game", sg.ID)
+			continue
+		}
+		c.states.mu.Lock()
+		c.states.games[sg.ChannelID] = g
+		c.states.mu.Unlock()
+		c.publish(g, nil)
+		n++
+	}
+	return n, os.Remove(c.gamesFile)
+}
+
+func (c *ChessHandler) restoreGame(sg savedGame) (*game, error) {
+	tc, err := parseTimeControl(sg.TimeControl)
+	if err != nil {
+		return nil, err
+	}
+	// games saved before the level was kept get the guild level
+	lvl := c.settings(sg.GuildID).botLevel
+	if sg.BotLevel != nil {
+		lvl = *sg.BotLevel
+	}
+	var eng Engine
+	if sg.Bot {
+		if eng, err = c.newEngine(lvl); err != nil {
+			return nil, err
+		}
+	}
+
+	g := newGame(sg.GuildID, sg.ChannelID, sg.WhiteID, sg.BlackID, eng, tc)
+	g.botLevel = lvl
+	g.id = sg.ID
+	g.createdAt = sg.CreatedAt
+	g.evalBar = sg.EvalBar
+	for _, s := range sg.Moves {
+		m, err := chess.UCINotation{}.Decode(g.Position(), s)
+		if err == nil {
+			err = g.Game.Move(m)
+		}
+		if err != nil {
+			g.Close()
+			return nil, fmt.Errorf("move %q: %w", s, err)
+		}
+	}
+	// the clocks don't run while the bot is down, resumeClock starts them
+	// again when the board is sent
+	if g.clock != nil {
+		g.clock.left[chess.White] = sg.WhiteLeft
+		g.clock.left[chess.Black] = sg.BlackLeft
+	}
+	return g, nil
+}
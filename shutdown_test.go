@@ -0,0 +1,198 @@
+package discordchess
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+	"github.com/notnil/chess"
+)
+
+// blockingEngine waits for a release before each move.
+type blockingEngine struct {
+	firstMoveEngine
+	searching chan struct{}
+	release   chan struct{}
+	closed    chan struct{}
+}
+
+func (e *blockingEngine) Search(pos *chess.Position, d time.Duration) (*chess.Move, chessimage.Eval, error) {
+	e.searching <- struct{}{}
+	<-e.release
+	return e.firstMoveEngine.Search(pos, d)
+}
+
+func (e *blockingEngine) Close() error {
+	close(e.closed)
+	return nil
+}
+
+// waitClosing waits for the handler to stop accepting commands.
+func waitClosing(c *ChessHandler) {
+	for {
+		c.closingMu.RLock()
+		closing := c.closing
+		c.closingMu.RUnlock()
+		if closing {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.json")
+	eng := &blockingEngine{
+		searching: make(chan struct{}),
+		release:   make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	c, err := New("!", "", []string{"guild:admin"}, WithGamesFile(path), WithEngine(func(int) (Engine, error) {
+		return eng, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	c.HandleMessage(s, step{author: "admin", content: "!config set time 5+0", roles: []string{"admin"}}.message(0))
+	c.HandleMessage(s, step{author: "admin", content: "!config set level 5", roles: []string{"admin"}}.message(0))
+	c.HandleMessage(s, step{author: "white", content: "!play <@white> <@bot>"}.message(1))
+
+	// the bot is thinking when the shutdown starts
+	moved := make(chan struct{})
+	go func() {
+		c.HandleMessage(s, moves("e4")[0].message(2))
+		close(moved)
+	}()
+	<-eng.searching
+
+	shutdown := make(chan error)
+	go func() { shutdown <- c.Shutdown(context.Background(), s) }()
+	waitClosing(c)
+	c.HandleMessage(s, step{author: "white", content: "!help"}.message(3))
+	eng.release <- struct{}{}
+	<-moved
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-eng.closed:
+	default:
+		t.Error("engine not closed")
+	}
+	if c.states.game(testChannel) != nil {
+		t.Error("game still in progress after shutdown")
+	}
+	got := s.reset()
+	want := []sent{
+		{"message", testChannel, "<@white> turn!"},
+		{"message", testChannel, "Bot restarting, your game is saved"},
+	}
+	if !containsSends(got, want) {
+		t.Errorf("sends %v, want %v", got, want)
+	}
+	for _, sn := range got {
+		if sn.content == "Help:" {
+			t.Error("command accepted during shutdown")
+		}
+	}
+
+	// A new handler restores the game with the bot move and level
+	eng2 := &blockingEngine{closed: make(chan struct{})}
+	level := -1
+	c2, err := New("!", "", nil, WithGamesFile(path), WithEngine(func(lvl int) (Engine, error) {
+		level = lvl
+		return eng2, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := c2.LoadGames()
+	if err != nil || n != 1 {
+		t.Fatalf("restored %d games, %v", n, err)
+	}
+	g := c2.states.game(testChannel)
+	if g == nil {
+		t.Fatal("game not restored")
+	}
+	if len(g.Moves()) != 2 || g.eng == nil || g.clock == nil {
+		t.Errorf("restored %d moves, engine %v, clock %v", len(g.Moves()), g.eng, g.clock)
+	}
+	if g.whiteID != "white" || g.blackID != "bot" {
+		t.Errorf("restored players %s, %s", g.whiteID, g.blackID)
+	}
+	if level != 5 || g.botLevel != 5 {
+		t.Errorf("restored bot level %d, engine level %d, want 5", g.botLevel, level)
+	}
+	// the clock waits for the board to be shown again
+	if !g.clock.turnStart.IsZero() {
+		t.Error("clock started before the board was sent")
+	}
+	c2.HandleMessage(s, step{author: "white", content: "!board"}.message(4))
+	g.lock()
+	started := !g.clock.turnStart.IsZero()
+	g.unlock()
+	if !started {
+		t.Error("clock not started by the board")
+	}
+	if n, _ := c2.LoadGames(); n != 0 {
+		t.Error("games restored twice")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.json")
+	eng := &blockingEngine{
+		searching: make(chan struct{}),
+		release:   make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	c, err := New("!", "", nil, WithGamesFile(path), WithEngine(func(int) (Engine, error) {
+		return eng, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	c.HandleMessage(s, step{author: "white", content: "!play <@white> <@bot>"}.message(1))
+
+	// the bot is still thinking when the shutdown gives up
+	moved := make(chan struct{})
+	go func() {
+		c.HandleMessage(s, moves("e4")[0].message(2))
+		close(moved)
+	}()
+	<-eng.searching
+	defer func() {
+		eng.release <- struct{}{}
+		<-moved
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx, s); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-eng.closed:
+		t.Error("engine closed while searching")
+	default:
+	}
+	want := []sent{{"message", testChannel, "Bot restarting, sorry, your game couldn't be saved."}}
+	if got := s.reset(); !containsSends(got, want) {
+		t.Errorf("sends %v, want %v", got, want)
+	}
+
+	c2, err := New("!", "", nil, WithGamesFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c2.LoadGames(); n != 0 || err != nil {
+		t.Errorf("restored %d games, %v, want the busy game dropped", n, err)
+	}
+}
@@ -14,17 +14,17 @@ type state struct {
 	mu    sync.Mutex
 }
 
-func (s *state) newGame(channelID, whiteID, blackID string, initUCI bool) (*game, error) {
+// newGame starts the game of the channel, it is returned locked for the
+// caller to set it up.
+func (s *state) newGame(guildID, channelID, whiteID, blackID string, eng Engine, tc timeControl) *game {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	g, err := newGame(whiteID, blackID, initUCI)
-	if err != nil {
-		return nil, err
-	}
+	g := newGame(guildID, channelID, whiteID, blackID, eng, tc)
+	g.lock()
 	s.games[channelID] = g
 
-	return g, nil
+	return g
 }
 
 func (s *state) game(channelID string) *game {
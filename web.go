@@ -0,0 +1,313 @@
+package discordchess
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DiscordGophers/discordchess/chessimage"
+)
+
+//go:embed web/*.html
+var webFiles embed.FS
+
+var webTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"clock": formatClock,
+}).ParseFS(webFiles, "web/*.html"))
+
+// keepAlive is the interval of the comments sent to idle event streams so
+// proxies don't close them.
+const keepAlive = 30 * time.Second
+
+// WebHandler serves the spectator pages under /watch/: the list of games,
+// a page per game updated live with server sent events and the replays of
+// the finished games, and the stream overlays under /overlay/{id}.
+func (c *ChessHandler) WebHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) == 1 && parts[0] == "watch" {
+			c.serveGameList(w, r)
+			return
+		}
+		if len(parts) < 2 || len(parts) > 3 {
+			http.NotFound(w, r)
+			return
+		}
+		v := c.live.get(parts[1])
+		if v == nil {
+			http.NotFound(w, r)
+			return
+		}
+		file := ""
+		if len(parts) == 3 {
+			file = parts[2]
+		}
+
+		switch parts[0] + "/" + file {
+		case "watch/":
+			c.serveGamePage(w, r, v)
+		case "watch/events", "overlay/events":
+			c.serveEvents(w, r, v)
+		case "watch/board.svg", "watch/board.png":
+			c.serveBoard(w, r, v, strings.TrimPrefix(file, "board."))
+		case "overlay/":
+			c.render(w, "overlay.html", map[string]interface{}{
+				"Game":  v,
+				"Clock": v.clockAt(time.Now().UTC()),
+			})
+		case "overlay/board.png":
+			c.serveOverlayBoard(w, r, v)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (c *ChessHandler) serveGameList(w http.ResponseWriter, r *http.Request) {
+	active, finished := c.live.list()
+	c.render(w, "games.html", map[string]interface{}{
+		"Active":   active,
+		"Finished": finished,
+	})
+}
+
+func (c *ChessHandler) serveGamePage(w http.ResponseWriter, r *http.Request, v *gameView) {
+	c.render(w, "game.html", map[string]interface{}{
+		"Game":  v,
+		"Clock": v.clockAt(time.Now().UTC()),
+	})
+}
+
+// render executes the template into a buffer first so errors don't send a
+// half page.
+func (c *ChessHandler) render(w http.ResponseWriter, name string, data interface{}) {
+	buf := &bytes.Buffer{}
+	if err := webTemplates.ExecuteTemplate(buf, name, data); err != nil {
+		c.log.error("failed to render page", err, "page", name)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// serveEvents streams the views of the game until it is over, dropped or
+// the client goes away.
+func (c *ChessHandler) serveEvents(w http.ResponseWriter, r *http.Request, v *gameView) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	views, cancel := c.live.subscribe(v.ID)
+	defer cancel()
+	// the game might have changed before subscribing
+	if cur := c.live.get(v.ID); cur != nil {
+		v = cur
+	}
+
+	// send writes v and reports whether the stream goes on
+	send := func(v *gameView) bool {
+		data, err := json.Marshal(v)
+		if err != nil {
+			c.log.error("failed to encode game", err, "game", v.ID)
+			return false
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		fl.Flush()
+		return !v.Over
+	}
+	if !send(v) {
+		return
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case next, ok := <-views:
+			if !ok {
+				fmt.Fprint(w, "event: removed\ndata: {}\n\n")
+				fl.Flush()
+				return
+			}
+			if !send(next) {
+				return
+			}
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep alive\n\n")
+			fl.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveBoard renders the position after the ply query parameter, the
+// current one by default, as svg or png.
+func (c *ChessHandler) serveBoard(w http.ResponseWriter, r *http.Request, v *gameView, format string) {
+	f := chessimage.Frame{FEN: v.FEN, Marks: v.marks}
+	if s := r.URL.Query().Get("ply"); s != "" {
+		ply, err := strconv.Atoi(s)
+		if err != nil || ply < 0 || ply >= len(v.frames) {
+			http.Error(w, "invalid ply", http.StatusBadRequest)
+			return
+		}
+		f = v.frames[ply]
+	}
+
+	drawer, err := c.webDrawer(chessimage.DefaultSize, false, false)
+	if err != nil {
+		c.log.error("failed to create drawer", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	buf := &bytes.Buffer{}
+	start := time.Now()
+	drawer.mu.Lock()
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = drawer.SVG(buf, f.FEN, f.Marks...)
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+		err = encodeBoardPNG(buf, drawer.Drawer, f)
+	}
+	drawer.mu.Unlock()
+	if err != nil {
+		c.log.error("failed to render board", err, "game", v.ID)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	c.metrics.render.observe(time.Since(start), "kind", "web")
+	// positions of a ply never change
+	if r.URL.Query().Get("ply") != "" {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+	buf.WriteTo(w)
+}
+
+func encodeBoardPNG(buf *bytes.Buffer, drawer *chessimage.Drawer, f chessimage.Frame) error {
+	im, err := drawer.Image(f.FEN, f.Marks...)
+	if err != nil {
+		return err
+	}
+	return png.Encode(buf, im)
+}
+
+// serveOverlayBoard renders the current position as a png with a
+// transparent background, the size query parameter sets its width.
+func (c *ChessHandler) serveOverlayBoard(w http.ResponseWriter, r *http.Request, v *gameView) {
+	size, err := querySize(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := c.boardPNG(v, size, true, false)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(data)
+}
+
+// querySize returns the size query parameter, the default size if empty.
+func querySize(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("size")
+	if s == "" {
+		return chessimage.DefaultSize, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < chessimage.MinSize || n > chessimage.MaxSize {
+		return 0, fmt.Errorf("size must be between %d and %d", chessimage.MinSize, chessimage.MaxSize)
+	}
+	return n, nil
+}
+
+// boardPNG renders the current position of v, errors are logged.
+func (c *ChessHandler) boardPNG(v *gameView, size int, transparent, flip bool) ([]byte, error) {
+	drawer, err := c.webDrawer(size, transparent, flip)
+	if err != nil {
+		c.log.error("failed to create drawer", err)
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	start := time.Now()
+	drawer.mu.Lock()
+	err = encodeBoardPNG(buf, drawer.Drawer, chessimage.Frame{FEN: v.FEN, Marks: v.marks})
+	drawer.mu.Unlock()
+	if err != nil {
+		c.log.error("failed to render board", err, "game", v.ID)
+		return nil, err
+	}
+	c.metrics.render.observe(time.Since(start), "kind", "web")
+	return buf.Bytes(), nil
+}
+
+// maxWebDrawers bounds the cache of the web drawers, the least recently
+// used is dropped past it.
+const maxWebDrawers = 8
+
+// webDrawer returns the drawer of the default theme with size.
+func (c *ChessHandler) webDrawer(size int, transparent, flip bool) (*sharedDrawer, error) {
+	key := fmt.Sprintf("%d/%t/%t", size, transparent, flip)
+
+	c.drawersMu.Lock()
+	defer c.drawersMu.Unlock()
+
+	if d, ok := c.webDrawers[key]; ok {
+		c.touchWebDrawer(key)
+		return d, nil
+	}
+	opts := []func(d *chessimage.Drawer){chessimage.WithSize(size)}
+	if t, ok := c.themes[c.defaultTheme]; ok {
+		opts = append(opts, chessimage.WithTheme(t))
+	}
+	if transparent {
+		opts = append(opts, chessimage.WithTransparentBackground())
+	}
+	if flip {
+		opts = append(opts, chessimage.WithFlip())
+	}
+	d, err := chessimage.NewDrawer(opts...)
+	if err != nil {
+		return nil, err
+	}
+	sd := &sharedDrawer{Drawer: d}
+	c.webDrawers[key] = sd
+	c.webDrawerKeys = append(c.webDrawerKeys, key)
+	if len(c.webDrawerKeys) > maxWebDrawers {
+		// a request may still be rendering with it, the garbage collector
+		// frees it after
+		delete(c.webDrawers, c.webDrawerKeys[0])
+		c.webDrawerKeys = c.webDrawerKeys[1:]
+	}
+	return sd, nil
+}
+
+// touchWebDrawer moves key to the most recently used end, c.drawersMu must
+// be held.
+func (c *ChessHandler) touchWebDrawer(key string) {
+	for i, k := range c.webDrawerKeys {
+		if k == key {
+			c.webDrawerKeys = append(c.webDrawerKeys[:i], c.webDrawerKeys[i+1:]...)
+			break
+		}
+	}
+	c.webDrawerKeys = append(c.webDrawerKeys, key)
+}
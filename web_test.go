@@ -0,0 +1,213 @@
+package discordchess
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestWebHandler(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	for i, st := range steps(start, moves("e4", "e5")) {
+		c.HandleMessage(s, st.message(i))
+	}
+	g := c.states.game(testChannel)
+
+	srv := httptest.NewServer(c.WebHandler())
+	defer srv.Close()
+
+	if code, body := get(t, srv.URL+"/watch/"); code != http.StatusOK || !strings.Contains(body, "/watch/"+g.id) {
+		t.Errorf("list = %d %q, want a link to the game", code, body)
+	}
+	if code, body := get(t, srv.URL+"/watch/"+g.id); code != http.StatusOK || !strings.Contains(body, "white vs black") {
+		t.Errorf("game page = %d %q", code, body)
+	}
+	if code, body := get(t, srv.URL+"/watch/"+g.id+"/board.svg"); code != http.StatusOK || !strings.HasPrefix(body, "<svg") {
+		t.Errorf("board = %d %.40q", code, body)
+	}
+	if code, _ := get(t, srv.URL+"/watch/"+g.id+"/board.png?ply=9"); code != http.StatusBadRequest {
+		t.Errorf("board of a missing ply = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code, _ := get(t, srv.URL+"/watch/nope"); code != http.StatusNotFound {
+		t.Errorf("missing game = %d, want %d", code, http.StatusNotFound)
+	}
+
+	// overlays
+	if code, body := get(t, srv.URL+"/overlay/"+g.id); code != http.StatusOK || !strings.Contains(body, "/overlay/\" + id + \"/board.png") {
+		t.Errorf("overlay = %d %q", code, body)
+	}
+	code, body := get(t, srv.URL+"/overlay/"+g.id+"/board.png?size=300")
+	im, err := png.Decode(strings.NewReader(body))
+	if code != http.StatusOK || err != nil {
+		t.Fatalf("overlay board = %d %v", code, err)
+	}
+	if b := im.Bounds(); b.Dx() != 300 {
+		t.Errorf("overlay board is %v, want the size 300", b)
+	}
+	if _, _, _, a := im.At(0, im.Bounds().Max.Y-1).RGBA(); a != 0 {
+		t.Errorf("overlay board background alpha = %d, want transparent", a)
+	}
+	if code, _ := get(t, srv.URL+"/overlay/"+g.id+"/board.png?size=10"); code != http.StatusBadRequest {
+		t.Errorf("overlay board too small = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	resp, err := http.Get(srv.URL + "/watch/" + g.id + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := make(chan gameView)
+	go func() {
+		defer close(events)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			data := strings.TrimPrefix(sc.Text(), "data: ")
+			if data == sc.Text() {
+				continue
+			}
+			v := gameView{}
+			if err := json.Unmarshal([]byte(data), &v); err != nil {
+				t.Error(err)
+				return
+			}
+			events <- v
+		}
+	}()
+	next := func() gameView {
+		t.Helper()
+		select {
+		case v := <-events:
+			return v
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		return gameView{}
+	}
+
+	if v := next(); len(v.Moves) != 2 || v.Turn != "white" {
+		t.Errorf("first event = %+v, want the current position", v)
+	}
+	for i, st := range moves("Qh5", "Nc6", "Bc4", "Nf6", "Qxf7") {
+		c.HandleMessage(s, st.message(i))
+	}
+	v := next()
+	for ; !v.Over; v = next() {
+	}
+	if v.Outcome != "1-0" || v.Method != "Checkmate" || len(v.Moves) != 7 {
+		t.Errorf("last event = %+v, want the checkmate", v)
+	}
+	if _, ok := <-events; ok {
+		t.Error("stream not closed after the game over")
+	}
+
+	// finished games are replays
+	if code, body := get(t, srv.URL+"/watch/"); !strings.Contains(body, "1-0 Checkmate") {
+		t.Errorf("list = %d %q, want the finished game", code, body)
+	}
+	if code, body := get(t, srv.URL+"/watch/"+g.id+"/board.svg?ply=3"); code != http.StatusOK || !strings.HasPrefix(body, "<svg") {
+		t.Errorf("replay board = %d %.40q", code, body)
+	}
+}
+
+// TestWebBoardsParallel renders the boards of concurrent requests with the
+// same cached drawers, run it with -race.
+func TestWebBoardsParallel(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	for i, st := range steps(start, moves("e4", "e5")) {
+		c.HandleMessage(s, st.message(i))
+	}
+	g := c.states.game(testChannel)
+
+	web := httptest.NewServer(c.WebHandler())
+	defer web.Close()
+	api := httptest.NewServer(c.APIHandler())
+	defer api.Close()
+
+	urls := []string{
+		web.URL + "/watch/" + g.id + "/board.png",
+		web.URL + "/watch/" + g.id + "/board.svg",
+		web.URL + "/watch/" + g.id + "/board.png?ply=1",
+		web.URL + "/overlay/" + g.id + "/board.png?size=300",
+		api.URL + "/games/" + g.id + "/board.png?size=300&flip=true",
+	}
+	errs := make(chan error, 4*len(urls))
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		for _, u := range urls {
+			wg.Add(1)
+			go func(u string) {
+				defer wg.Done()
+				resp, err := http.Get(u)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer resp.Body.Close()
+				if _, err := ioutil.ReadAll(resp.Body); err != nil || resp.StatusCode != http.StatusOK {
+					errs <- fmt.Errorf("%s = %d %v", u, resp.StatusCode, err)
+				}
+			}(u)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestWebDrawerCache(t *testing.T) {
+	c, err := New("!", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.webDrawer(300, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size := 301; size < 301+maxWebDrawers; size++ {
+		if _, err := c.webDrawer(size, true, false); err != nil {
+			t.Fatal(err)
+		}
+		// the first one stays the most recently used
+		if d, _ := c.webDrawer(300, true, false); d != first {
+			t.Fatalf("drawer of size 300 dropped after size %d", size)
+		}
+	}
+	if len(c.webDrawers) != maxWebDrawers || len(c.webDrawerKeys) != maxWebDrawers {
+		t.Errorf("cached %d drawers and %d keys, want %d", len(c.webDrawers), len(c.webDrawerKeys), maxWebDrawers)
+	}
+	if _, ok := c.webDrawers["301/true/false"]; ok {
+		t.Error("least recently used drawer not dropped")
+	}
+}
@@ -0,0 +1,521 @@
+package discordchess
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Webhook events.
+const (
+	webhookGameStarted   = "game_started"
+	webhookMove          = "move"
+	webhookGameOver      = "game_over"
+	webhookRatingChanged = "rating_changed"
+)
+
+// webhook is an url receiving the game events of a guild, the payloads are
+// signed with the secret.
+type webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// webhookEvent is the json payload posted to the webhooks.
+type webhookEvent struct {
+	ID      string         `json:"id"`
+	Event   string         `json:"event"`
+	Time    time.Time      `json:"time"`
+	Game    *gameView      `json:"game"`
+	PGN     string         `json:"pgn,omitempty"`
+	Ratings []ratingChange `json:"ratings,omitempty"`
+}
+
+// deadLetter is a delivery that failed every attempt.
+type deadLetter struct {
+	Time     time.Time       `json:"time"`
+	URL      string          `json:"url"`
+	Event    string          `json:"event"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// webhookQueue bounds the deliveries waiting per url.
+const webhookQueue = 256
+
+// defaultWebhookBackoff are the delays before the retries of a delivery.
+var defaultWebhookBackoff = []time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+}
+
+// delivery is a signed payload to post to an url.
+type delivery struct {
+	url     string
+	event   string
+	id      string
+	payload []byte
+	sig     string
+}
+
+// webhooks posts the deliveries in order per url, each url has its own
+// worker while it has deliveries so a slow one doesn't hold the others.
+type webhooks struct {
+	client  *http.Client
+	backoff []time.Duration
+	// allowPrivate lets the tests post to local servers
+	allowPrivate bool
+	// deadLetters receives the failed deliveries as json lines, if set
+	deadLetters io.Writer
+	deadMu      sync.Mutex
+	log         *logger
+	metrics     *metrics
+
+	queues map[string]chan delivery
+	closed bool
+	// stop cancels the requests and the retries
+	stop chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+}
+
+func newWebhooks(log *logger, m *metrics) *webhooks {
+	wh := &webhooks{
+		backoff: defaultWebhookBackoff,
+		log:     log,
+		metrics: m,
+		queues:  map[string]chan delivery{},
+		stop:    make(chan struct{}),
+	}
+	// the addresses are checked once resolved so a name can't point to
+	// the bot's network, no proxy would hide them
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if wh.allowPrivate {
+				return nil
+			}
+			return publicAddress(address)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	wh.client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return wh
+}
+
+// privateNets are the ranges of the networks that aren't reachable from the
+// internet.
+var privateNets = func() []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, s := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// publicIP reports whether ip is a public unicast address.
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// errPrivateAddress is returned when dialing the local networks, the
+// deliveries aren't retried.
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// publicAddress checks that the "host:port" address is a public ip.
+func publicAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, host)
+	}
+	return nil
+}
+
+// WithWebhookDeadLetters appends the webhook deliveries that failed every
+// attempt to w as json lines, they are only logged by default.
+func WithWebhookDeadLetters(w io.Writer) func(c *ChessHandler) {
+	return func(c *ChessHandler) {
+		c.webhooks.deadLetters = w
+	}
+}
+
+// send queues d, it is dead lettered if the queue of its url is full or
+// the webhooks are closed.
+func (wh *webhooks) send(d delivery) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.closed {
+		wh.deadLetter(d, 0, errors.New("shutting down"))
+		return
+	}
+	q, ok := wh.queues[d.url]
+	if !ok {
+		q = make(chan delivery, webhookQueue)
+		wh.queues[d.url] = q
+		wh.wg.Add(1)
+		go wh.run(d.url, q)
+	}
+	select {
+	case q <- d:
+	default:
+		wh.deadLetter(d, 0, errors.New("queue full"))
+	}
+}
+
+// run delivers the queue of url until it is empty.
+func (wh *webhooks) run(url string, q chan delivery) {
+	defer wh.wg.Done()
+	for {
+		wh.mu.Lock()
+		select {
+		case d := <-q:
+			wh.mu.Unlock()
+			wh.deliver(d)
+		default:
+			delete(wh.queues, url)
+			wh.mu.Unlock()
+			return
+		}
+	}
+}
+
+// deliver posts d, retrying with the backoff on network errors, server
+// errors and rate limits.
+func (wh *webhooks) deliver(d delivery) {
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		var retry bool
+		if retry, err = wh.post(d); err == nil {
+			wh.metrics.webhooks.inc("result", "ok")
+			return
+		}
+		if !retry || attempts > len(wh.backoff) {
+			break
+		}
+		wh.metrics.webhooks.inc("result", "retry")
+		select {
+		case <-time.After(wh.backoff[attempts-1]):
+		case <-wh.stop:
+			wh.deadLetter(d, attempts, fmt.Errorf("shutting down after: %w", err))
+			return
+		}
+	}
+	wh.deadLetter(d, attempts, err)
+}
+
+// post sends d once, it reports whether a failure is worth retrying.
+func (wh *webhooks) post(d delivery) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-wh.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "discordchess-webhook")
+	req.Header.Set("X-Discordchess-Event", d.event)
+	req.Header.Set("X-Discordchess-Delivery", d.id)
+	req.Header.Set("X-Discordchess-Signature", "sha256="+d.sig)
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return !errors.Is(err, errPrivateAddress), err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusRequestTimeout:
+		return true, fmt.Errorf("status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("status %s", resp.Status)
+	}
+}
+
+// deadLetter logs the failed delivery and writes it to the dead letters.
+func (wh *webhooks) deadLetter(d delivery, attempts int, err error) {
+	wh.metrics.webhooks.inc("result", "dead")
+	wh.log.error("webhook delivery failed", err, "url", d.url, "event", d.event, "attempts", attempts)
+	if wh.deadLetters == nil {
+		return
+	}
+	data, merr := json.Marshal(deadLetter{
+		Time:     time.Now().UTC(),
+		URL:      d.url,
+		Event:    d.event,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Payload:  d.payload,
+	})
+	if merr != nil {
+		wh.log.error("failed to encode dead letter", merr)
+		return
+	}
+	wh.deadMu.Lock()
+	defer wh.deadMu.Unlock()
+	if _, werr := wh.deadLetters.Write(append(data, '\n')); werr != nil {
+		wh.log.error("failed to write dead letter", werr)
+	}
+}
+
+// close stops accepting deliveries and waits for the queued ones, the
+// retries left are dead lettered once ctx is done.
+func (wh *webhooks) close(ctx context.Context) error {
+	wh.mu.Lock()
+	if wh.closed {
+		wh.mu.Unlock()
+		return nil
+	}
+	wh.closed = true
+	wh.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wh.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		close(wh.stop)
+		<-done
+		return fmt.Errorf("waiting for webhooks: %w", ctx.Err())
+	}
+}
+
+// sign returns the hex hmac-sha256 of payload with secret.
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand doesn't fail on the supported platforms
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// notify sends the event of the game to the webhooks of its guild.
+func (c *ChessHandler) notify(g *game, event string, fn func(ev *webhookEvent)) {
+	cfg, _ := c.config.get(g.guildID)
+	if len(cfg.Webhooks) == 0 {
+		return
+	}
+	v := c.live.get(g.id)
+	if v == nil {
+		return
+	}
+	ev := webhookEvent{
+		ID:    randomHex(8),
+		Event: event,
+		Time:  time.Now().UTC(),
+		Game:  current(v, time.Now().UTC()),
+	}
+	if fn != nil {
+		fn(&ev)
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		c.log.error("failed to encode webhook event", err, "game", g.id, "event", event)
+		return
+	}
+	for _, h := range cfg.Webhooks {
+		c.webhooks.send(delivery{
+			url:     h.URL,
+			event:   event,
+			id:      ev.ID,
+			payload: payload,
+			sig:     sign(h.Secret, payload),
+		})
+	}
+}
+
+// notifyProgress sends the start of the game or its new moves since prev,
+// the view before the last publish.
+func (c *ChessHandler) notifyProgress(g *game, prev *gameView) {
+	v := c.live.get(g.id)
+	switch {
+	case v == nil:
+	case prev == nil:
+		c.notify(g, webhookGameStarted, nil)
+	case len(v.Moves) > len(prev.Moves):
+		c.notify(g, webhookMove, nil)
+	}
+}
+
+// notifyGameOver sends the end of the game with its pgn and the rating
+// changes if rated.
+func (c *ChessHandler) notifyGameOver(g *game, changes []ratingChange) {
+	v := c.live.get(g.id)
+	if v == nil {
+		return
+	}
+	c.notify(g, webhookGameOver, func(ev *webhookEvent) {
+		ev.PGN = v.pgn()
+	})
+	if len(changes) > 0 {
+		c.notify(g, webhookRatingChanged, func(ev *webhookEvent) {
+			ev.Ratings = changes
+		})
+	}
+}
+
+// validURL checks that s is an absolute http or https url, the ones naming
+// a local host are refused early, the names are checked when posting.
+func (wh *webhooks) validURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return GameError("The webhook must be an http or https url")
+	}
+	host := strings.ToLower(u.Hostname())
+	ip := net.ParseIP(host)
+	if wh.allowPrivate {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !publicIP(ip)) {
+		return GameError("The webhook must be on a public address")
+	}
+	return nil
+}
+
+// redactURL returns the scheme and host of the url, the path and query
+// often hold a token.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return "…"
+	}
+	res := u.Scheme + "://" + u.Host
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		res += "/…"
+	}
+	return res
+}
+
+// configWebhook adds, removes or lists the webhooks of the guild, the
+// secret of a new webhook is sent to the admin in a direct message.
+func (c *ChessHandler) configWebhook(r *request) error {
+	action := ""
+	if len(r.args) > 1 {
+		action = strings.ToLower(r.args[1])
+	}
+	usage := GameError(fmt.Sprintf("Usage: `%sconfig webhook add|remove <url>` or `%sconfig webhook list`", r.cfg.prefix, r.cfg.prefix))
+
+	switch {
+	case action == "list" && len(r.args) == 2:
+		cfg, _ := c.config.get(r.m.GuildID)
+		if len(cfg.Webhooks) == 0 {
+			return r.reply("No webhooks")
+		}
+		urls := []string{}
+		for _, h := range cfg.Webhooks {
+			urls = append(urls, "`"+redactURL(h.URL)+"`")
+		}
+		return r.reply("Webhooks:\n" + strings.Join(urls, "\n"))
+	case action == "add" && len(r.args) == 3:
+		u := r.args[2]
+		if err := c.webhooks.validURL(u); err != nil {
+			return err
+		}
+		secret := randomHex(16)
+		err := c.config.update(r.m.GuildID, func(g *guildConfig) error {
+			for _, h := range g.Webhooks {
+				if h.URL == u {
+					return GameError("This webhook is already added")
+				}
+			}
+			g.Webhooks = append(g.Webhooks, webhook{URL: u, Secret: secret})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		dm, err := r.s.UserChannelCreate(r.m.Author.ID)
+		if err == nil {
+			_, err = r.s.ChannelMessageSend(dm.ID, fmt.Sprintf("The payloads of the webhook %s are signed with the secret `%s` in the `X-Discordchess-Signature` header.", redactURL(u), secret))
+		}
+		if err != nil {
+			// nobody knows the secret, the webhook is useless
+			r.log.error("failed to send the webhook secret", err)
+			if err := c.removeWebhook(r.m.GuildID, u); err != nil {
+				return err
+			}
+			return GameError("I couldn't send you the secret of the webhook, allow direct messages from the server members and add it again")
+		}
+		return r.reply("Webhook added, the secret signing the payloads is in your direct messages.")
+	case action == "remove" && len(r.args) == 3:
+		if err := c.removeWebhook(r.m.GuildID, r.args[2]); err != nil {
+			return err
+		}
+		return r.react()
+	}
+	return usage
+}
+
+// removeWebhook removes the webhook at u from the guild.
+func (c *ChessHandler) removeWebhook(guildID, u string) error {
+	return c.config.update(guildID, func(g *guildConfig) error {
+		hooks := g.Webhooks[:0]
+		for _, h := range g.Webhooks {
+			if h.URL != u {
+				hooks = append(hooks, h)
+			}
+		}
+		if len(hooks) == len(g.Webhooks) {
+			return GameError("No such webhook")
+		}
+		g.Webhooks = hooks
+		return nil
+	})
+}
@@ -0,0 +1,229 @@
+package discordchess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	type received struct {
+		event, sig string
+		body       []byte
+	}
+	var (
+		mu       sync.Mutex
+		got      []received
+		failures int
+		flaked   bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/down":
+			failures++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/flaky":
+			// the first attempt fails
+			if !flaked {
+				flaked = true
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fallthrough
+		default:
+			got = append(got, received{r.Header.Get("X-Discordchess-Event"), r.Header.Get("X-Discordchess-Signature"), body})
+		}
+	}))
+	defer srv.Close()
+
+	dead := &bytes.Buffer{}
+	c, err := New("!", "", nil, WithWebhookDeadLetters(dead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.webhooks.backoff = []time.Duration{time.Millisecond, time.Millisecond}
+	// the test server is local
+	c.webhooks.allowPrivate = true
+	s := newFakeSession("bot")
+	send := func(st step) []sent {
+		c.HandleMessage(s, st.message(0))
+		return s.reset()
+	}
+	admin := func(content string) []sent {
+		return send(step{author: "admin", content: content, roles: []string{"boss"}})
+	}
+
+	res := admin("!config webhook add " + srv.URL + "/flaky?token=abc")
+	if !containsSends(res, []sent{{"reply", testChannel, "Webhook added, the secret signing the payloads is in your direct messages."}}) {
+		t.Errorf("add sent %v", res)
+	}
+	secretRE := regexp.MustCompile("`([0-9a-f]{32})`")
+	secret := ""
+	for _, sn := range res {
+		m := secretRE.FindStringSubmatch(sn.content)
+		switch {
+		case m == nil:
+		case sn.channelID != "dm:admin":
+			t.Errorf("secret sent to %s", sn.channelID)
+		default:
+			secret = m[1]
+		}
+	}
+	if secret == "" {
+		t.Fatalf("add sent %v, want the secret in a direct message", res)
+	}
+	admin("!config webhook add " + srv.URL + "/down")
+	if res := admin("!config webhook add ftp://example.com"); !containsSends(res, []sent{{"reply", testChannel, "The webhook must be an http or https url"}}) {
+		t.Errorf("add invalid url sent %v", res)
+	}
+	if res := admin("!config webhook list"); !containsSends(res, []sent{{"reply", testChannel, "Webhooks:\n`" + srv.URL + "/…`\n`" + srv.URL + "/…`"}}) {
+		t.Errorf("list sent %v", res)
+	}
+	if strings.Contains(sentContent(res), "token") {
+		t.Errorf("list sent the token: %v", res)
+	}
+
+	// without direct messages nobody would know the secret
+	s.dmErr = errors.New("cannot send messages to this user")
+	if res := admin("!config webhook add https://example.com/hook"); !containsSends(res, []sent{{"reply", testChannel, "I couldn't send you the secret"}}) {
+		t.Errorf("add without direct messages sent %v", res)
+	}
+	s.dmErr = nil
+	if cfg, _ := c.config.get("guild"); len(cfg.Webhooks) != 2 {
+		t.Errorf("%d webhooks, want the one without a secret removed", len(cfg.Webhooks))
+	}
+	if res := admin("!config webhook remove " + srv.URL + "/nope"); !containsSends(res, []sent{{"reply", testChannel, "No such webhook"}}) {
+		t.Errorf("remove unknown sent %v", res)
+	}
+
+	for i, st := range steps(start, moves("e4", "e5", "Qh5", "Nc6", "Bc4", "Nf6", "Qxf7")) {
+		c.HandleMessage(s, st.message(i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Shutdown(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	events := []string{}
+	for _, r := range got {
+		events = append(events, r.event)
+		if r.sig != "sha256="+sign(secret, r.body) {
+			t.Errorf("%s signature = %q, want the hmac of the body", r.event, r.sig)
+		}
+	}
+	want := "game_started move move move move move move move game_over rating_changed"
+	if strings.Join(events, " ") != want {
+		t.Fatalf("events = %v, want %s", events, want)
+	}
+
+	over := webhookEvent{}
+	if err := json.Unmarshal(got[8].body, &over); err != nil {
+		t.Fatal(err)
+	}
+	if !over.Game.Over || over.Game.Outcome != "1-0" || !strings.Contains(over.PGN, "4. Qxf7# 1-0") {
+		t.Errorf("game over = %+v", over)
+	}
+	rated := webhookEvent{}
+	if err := json.Unmarshal(got[9].body, &rated); err != nil {
+		t.Fatal(err)
+	}
+	wantRatings := []ratingChange{{"white", 1200, 1216}, {"black", 1200, 1184}}
+	if len(rated.Ratings) != 2 || rated.Ratings[0] != wantRatings[0] || rated.Ratings[1] != wantRatings[1] {
+		t.Errorf("ratings = %+v, want %+v", rated.Ratings, wantRatings)
+	}
+
+	// every event to the down url is retried twice then dead lettered
+	if failures != 10*3 {
+		t.Errorf("%d failed requests, want %d", failures, 10*3)
+	}
+	lines := strings.Split(strings.TrimSpace(dead.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("%d dead letters, want 10", len(lines))
+	}
+	dl := deadLetter{}
+	if err := json.Unmarshal([]byte(lines[0]), &dl); err != nil {
+		t.Fatal(err)
+	}
+	if dl.URL != srv.URL+"/down" || dl.Event != "game_started" || dl.Attempts != 3 || !strings.Contains(dl.Error, "503") {
+		t.Errorf("dead letter = %+v", dl)
+	}
+}
+
+// sentContent joins the content of the sent messages.
+func sentContent(res []sent) string {
+	parts := []string{}
+	for _, s := range res {
+		parts = append(parts, s.content)
+	}
+	return strings.Join(parts, "\n")
+}
+
+func TestWebhooksPrivateAddresses(t *testing.T) {
+	hit := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit <- struct{}{}
+	}))
+	defer srv.Close()
+
+	dead := &bytes.Buffer{}
+	c, err := New("!", "", nil, WithWebhookDeadLetters(dead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeSession("bot")
+	for _, u := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.1.2.3/hook",
+		"http://[::1]/hook",
+		srv.URL + "/hook",
+	} {
+		c.HandleMessage(s, step{author: "admin", content: "!config webhook add " + u, roles: []string{"boss"}}.message(0))
+		if got := s.reset(); !containsSends(got, []sent{{"reply", testChannel, "The webhook must be on a public address"}}) {
+			t.Errorf("add %s sent %v", u, got)
+		}
+	}
+
+	// a name resolving to a private address is dead lettered
+	err = c.config.update("guild", func(g *guildConfig) error {
+		g.Webhooks = append(g.Webhooks, webhook{URL: strings.Replace(srv.URL, "127.0.0.1", "localhost", 1), Secret: "secret"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HandleMessage(s, start[0].message(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Shutdown(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-hit:
+		t.Error("webhook posted to a private address")
+	default:
+	}
+	dl := deadLetter{}
+	if err := json.Unmarshal(bytes.SplitN(dead.Bytes(), []byte("\n"), 2)[0], &dl); err != nil {
+		t.Fatalf("dead letters %q: %v", dead, err)
+	}
+	if dl.Event != "game_started" || !strings.Contains(dl.Error, "is not public") {
+		t.Errorf("dead letter = %+v", dl)
+	}
+}